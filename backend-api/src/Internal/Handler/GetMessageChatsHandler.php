@@ -0,0 +1,62 @@
+<?php
+
+declare(strict_types=1);
+
+namespace App\Internal\Handler;
+
+use App\Message\Repository\MessageRepository;
+use Symfony\Bundle\FrameworkBundle\Controller\AbstractController;
+use Symfony\Component\HttpFoundation\JsonResponse;
+use Symfony\Component\HttpFoundation\Request;
+use Symfony\Component\HttpFoundation\Response;
+use Symfony\Component\Routing\Annotation\Route;
+
+#[Route('/api/internal/v1/messages/chats', name: 'api_internal_messages_chats', methods: ['POST'])]
+final class GetMessageChatsHandler extends AbstractController
+{
+    public function __construct(
+        private readonly MessageRepository $messageRepository,
+    ) {}
+
+    public function __invoke(Request $request): JsonResponse
+    {
+        // Check internal API key
+        $apiKey = $request->headers->get('X-Internal-API-Key');
+        $expectedKey = $_ENV['INTERNAL_API_KEY'] ?? 'change_me_in_production';
+
+        if ($apiKey !== $expectedKey) {
+            return new JsonResponse(
+                ['error' => 'Invalid API key'],
+                Response::HTTP_UNAUTHORIZED
+            );
+        }
+
+        $data = json_decode($request->getContent(), true);
+        $messageIds = $data['message_ids'] ?? null;
+
+        if (!is_array($messageIds) || count($messageIds) === 0) {
+            return new JsonResponse(
+                ['error' => 'message_ids required'],
+                Response::HTTP_BAD_REQUEST
+            );
+        }
+
+        $messages = $this->messageRepository->findBy([
+            'id' => array_map('intval', $messageIds),
+        ]);
+
+        $result = array_map(
+            function ($message) {
+                return [
+                    'message_id' => $message->getId(),
+                    'chat_id' => $message->getChat()->getId(),
+                ];
+            },
+            $messages
+        );
+
+        return new JsonResponse([
+            'messages' => $result,
+        ]);
+    }
+}
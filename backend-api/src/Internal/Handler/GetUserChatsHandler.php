@@ -0,0 +1,48 @@
+<?php
+
+declare(strict_types=1);
+
+namespace App\Internal\Handler;
+
+use App\Chat\Repository\ChatRepository;
+use Symfony\Bundle\FrameworkBundle\Controller\AbstractController;
+use Symfony\Component\HttpFoundation\JsonResponse;
+use Symfony\Component\HttpFoundation\Request;
+use Symfony\Component\HttpFoundation\Response;
+use Symfony\Component\Routing\Annotation\Route;
+
+#[Route('/api/internal/v1/users/{userId}/chats', name: 'api_internal_users_chats', methods: ['GET'])]
+final class GetUserChatsHandler extends AbstractController
+{
+    public function __construct(
+        private readonly ChatRepository $chatRepository,
+    ) {}
+
+    public function __invoke(int $userId, Request $request): JsonResponse
+    {
+        // Check internal API key
+        $apiKey = $request->headers->get('X-Internal-API-Key');
+        $expectedKey = $_ENV['INTERNAL_API_KEY'] ?? 'change_me_in_production';
+
+        if ($apiKey !== $expectedKey) {
+            return new JsonResponse(
+                ['error' => 'Invalid API key'],
+                Response::HTTP_UNAUTHORIZED
+            );
+        }
+
+        $chats = $this->chatRepository->findUserChats($userId);
+
+        $chatIds = array_map(
+            function ($chat) {
+                return $chat->getId();
+            },
+            $chats
+        );
+
+        return new JsonResponse([
+            'user_id' => $userId,
+            'chat_ids' => $chatIds,
+        ]);
+    }
+}
@@ -69,6 +69,7 @@ final class ValidateTokenHandler extends AbstractController
             return new JsonResponse([
                 'valid' => true,
                 'user' => $userResponse->toArray(),
+                'expires_at' => isset($payload['exp']) ? (int) $payload['exp'] : null,
             ]);
         } catch (\Throwable $e) {
             return new JsonResponse(
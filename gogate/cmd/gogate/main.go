@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/broker"
 	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/metrics"
 	"buzzchat-gogate/internal/ws"
 
 	"github.com/joho/godotenv"
@@ -24,30 +31,100 @@ func main() {
 	log.Printf("Starting GoGate WebSocket Gateway...")
 	log.Printf("Backend API URL: %s", cfg.BackendAPIURL)
 	log.Printf("Server Port: %s", cfg.Port)
+	if cfg.DevMode {
+		log.Printf("WARNING: DEV_MODE is enabled, WebSocket origin checks are disabled")
+	} else {
+		log.Printf("Allowed origins: %v", cfg.AllowedOrigins)
+	}
+
+	// Create metrics registry, served at /metrics
+	registry := metrics.NewRegistry()
 
 	// Create Backend API client
-	apiClient := api.NewClient(cfg.BackendAPIURL, cfg.InternalAPIKey)
+	apiClient := api.NewClient(cfg.BackendAPIURL, cfg.InternalAPIKey, registry)
+
+	// Create broker distributing events between gateway instances
+	var bus broker.Broker
+	switch cfg.Broker {
+	case config.BrokerRedis:
+		log.Printf("Broker: redis at %s, channel %s", cfg.RedisAddr, cfg.RedisChannel)
+		bus = broker.NewRedisBroker(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisChannel)
+	default:
+		log.Printf("Broker: memory (single instance)")
+		bus = broker.NewMemoryBroker()
+	}
 
 	// Create Hub
-	hub := ws.NewHub(apiClient)
+	hub, err := ws.NewHub(apiClient, bus, registry, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create hub: %v", err)
+	}
 	go hub.Run()
 
 	// Create WebSocket handler
-	wsHandler := ws.NewHandler(hub)
+	wsHandler, err := ws.NewHandler(hub, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create WebSocket handler: %v", err)
+	}
+
+	// Create connection ticket handler
+	ticketHandler, err := ws.NewTicketHandler(hub, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create ticket handler: %v", err)
+	}
+
+	// Create internal push handler (backend -> gateway)
+	pushHandler := ws.NewPushHandler(hub, cfg.InternalAPIKey)
+
+	// Create internal disconnect handler (backend -> gateway)
+	disconnectHandler := ws.NewDisconnectHandler(hub, cfg.InternalAPIKey)
 
 	// Setup HTTP routes
 	http.HandleFunc("/ws", wsHandler.ServeHTTP)
+	http.HandleFunc("/ws/ticket", ticketHandler.ServeHTTP)
+	http.HandleFunc("/internal/push", pushHandler.ServeHTTP)
+	http.HandleFunc("/internal/disconnect", disconnectHandler.ServeHTTP)
 	http.HandleFunc("/health", healthHandler)
+	if cfg.MetricsEnabled {
+		http.Handle("/metrics", registry)
+	}
 	http.HandleFunc("/", rootHandler)
 
 	// Start HTTP server
 	addr := ":" + cfg.Port
-	log.Printf("GoGate is listening on %s", addr)
-	log.Printf("WebSocket endpoint: ws://localhost%s/ws", addr)
+	server := &http.Server{Addr: addr}
+
+	go func() {
+		log.Printf("GoGate is listening on %s", addr)
+		log.Printf("WebSocket endpoint: ws://localhost%s/ws", addr)
+
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	// Wait for termination signal
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
 
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("Server error: %v", err)
+	log.Printf("Shutdown signal received, draining connections...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	// Stop accepting new connections, then drain WebSocket clients
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Hub shutdown error: %v", err)
 	}
+	if err := bus.Close(); err != nil {
+		log.Printf("Broker close error: %v", err)
+	}
+
+	log.Printf("GoGate stopped")
 }
 
 // healthHandler returns health status
@@ -66,5 +143,5 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("GoGate WebSocket Gateway\n\nWebSocket endpoint: /ws\nHealth check: /health\n"))
+	w.Write([]byte("GoGate WebSocket Gateway\n\nWebSocket endpoint: /ws\nTicket endpoint: /ws/ticket\nHealth check: /health\nMetrics: /metrics\n"))
 }
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"buzzchat-gogate/internal/metrics"
 	"buzzchat-gogate/internal/models"
 )
 
@@ -15,69 +16,74 @@ type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	metrics    requestMetrics
 }
 
-func NewClient(baseURL, apiKey string) *Client {
+// NewClient creates a backend client recording request metrics in reg
+func NewClient(baseURL, apiKey string, reg *metrics.Registry) *Client {
 	return &Client{
 		baseURL: baseURL,
 		apiKey:  apiKey,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		metrics: newRequestMetrics(reg),
 	}
 }
 
-// ValidateToken validates JWT token and returns user info
-func (c *Client) ValidateToken(token string) (*models.User, error) {
+// ValidateToken validates JWT token and returns user info and the token's
+// expiry (zero if unknown)
+func (c *Client) ValidateToken(token string) (*models.User, time.Time, error) {
 	reqBody := map[string]string{"token": token}
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
+		return nil, time.Time{}, fmt.Errorf("marshal request: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", c.baseURL+"/api/internal/v1/auth/validate", bytes.NewReader(bodyBytes))
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, time.Time{}, fmt.Errorf("create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Internal-API-Key", c.apiKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("ValidateToken", req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, time.Time{}, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, time.Time{}, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			return nil, fmt.Errorf("backend error: %s", errResp.Error)
-		}
-		return nil, fmt.Errorf("backend error: status %d", resp.StatusCode)
+		return nil, time.Time{}, newError(resp.StatusCode, body)
 	}
 
 	var result struct {
-		Valid bool         `json:"valid"`
-		User  models.User  `json:"user"`
+		Valid     bool         `json:"valid"`
+		User      models.User  `json:"user"`
+		ExpiresAt int64        `json:"expires_at"`
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("unmarshal response: %w", err)
+		return nil, time.Time{}, fmt.Errorf("unmarshal response: %w", err)
 	}
 
 	if !result.Valid {
-		return nil, fmt.Errorf("invalid token")
+		return nil, time.Time{}, &Error{StatusCode: http.StatusUnauthorized, Message: "invalid token"}
 	}
 
-	return &result.User, nil
+	// Prefer the expiry reported by the backend, fall back to the exp claim
+	expiresAt := tokenExpiry(token)
+	if result.ExpiresAt > 0 {
+		expiresAt = time.Unix(result.ExpiresAt, 0)
+	}
+
+	return &result.User, expiresAt, nil
 }
 
 // GetChatMembers returns list of chat members
@@ -89,25 +95,19 @@ func (c *Client) GetChatMembers(chatID int) ([]models.ChatMember, error) {
 
 	req.Header.Set("X-Internal-API-Key", c.apiKey)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("GetChatMembers", req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			return nil, fmt.Errorf("backend error: %s", errResp.Error)
-		}
-		return nil, fmt.Errorf("backend error: status %d", resp.StatusCode)
+		return nil, newError(resp.StatusCode, body)
 	}
 
 	var result struct {
@@ -119,9 +119,104 @@ func (c *Client) GetChatMembers(chatID int) ([]models.ChatMember, error) {
 		return nil, fmt.Errorf("unmarshal response: %w", err)
 	}
 
+	// Membership checks rely on the IDs; a member decoded without one means
+	// the payload changed and would make everyone look like a non-member
+	for _, member := range result.Members {
+		if member.UserID <= 0 {
+			return nil, fmt.Errorf("unmarshal response: chat %d member without id", chatID)
+		}
+	}
+
 	return result.Members, nil
 }
 
+// GetMessageChats resolves the chat of each given message (messageID -> chatID)
+func (c *Client) GetMessageChats(messageIDs []int) (map[int]int, error) {
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"message_ids": messageIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", c.baseURL+"/api/internal/v1/messages/chats", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Internal-API-Key", c.apiKey)
+
+	resp, err := c.do("GetMessageChats", req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError(resp.StatusCode, body)
+	}
+
+	var result struct {
+		Messages []struct {
+			MessageID int `json:"message_id"`
+			ChatID    int `json:"chat_id"`
+		} `json:"messages"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	chats := make(map[int]int, len(result.Messages))
+	for _, m := range result.Messages {
+		chats[m.MessageID] = m.ChatID
+	}
+
+	return chats, nil
+}
+
+// GetUserChats returns IDs of chats the user is a member of
+func (c *Client) GetUserChats(userID int) ([]int, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/internal/v1/users/%d/chats", c.baseURL, userID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("X-Internal-API-Key", c.apiKey)
+
+	resp, err := c.do("GetUserChats", req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError(resp.StatusCode, body)
+	}
+
+	var result struct {
+		UserID  int   `json:"user_id"`
+		ChatIDs []int `json:"chat_ids"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %w", err)
+	}
+
+	return result.ChatIDs, nil
+}
+
 // SendMessage forwards message to backend API
 func (c *Client) SendMessage(token string, data models.SendMessageData) (json.RawMessage, error) {
 	bodyBytes, err := json.Marshal(map[string]interface{}{
@@ -142,30 +237,82 @@ func (c *Client) SendMessage(token string, data models.SendMessageData) (json.Ra
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("SendMessage", req)
 	if err != nil {
-		return nil, fmt.Errorf("do request: %w", err)
+		return nil, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+		return nil, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
 	}
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			return nil, fmt.Errorf("backend error: %s", errResp.Error)
-		}
-		return nil, fmt.Errorf("backend error: status %d", resp.StatusCode)
+		return nil, newError(resp.StatusCode, body)
 	}
 
 	return json.RawMessage(body), nil
 }
 
+// UpdateMessage forwards message edit to backend API
+func (c *Client) UpdateMessage(token string, data models.EditMessageData) (json.RawMessage, error) {
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"text": data.Text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("PATCH", fmt.Sprintf("%s/api/v1/messages/%d", c.baseURL, data.MessageID), bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.do("UpdateMessage", req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w: %w", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newError(resp.StatusCode, body)
+	}
+
+	return json.RawMessage(body), nil
+}
+
+// DeleteMessage forwards message deletion to backend API
+func (c *Client) DeleteMessage(token string, messageID int) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/api/v1/messages/%d", c.baseURL, messageID), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.do("DeleteMessage", req)
+	if err != nil {
+		return fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return newError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
 // AddReaction forwards reaction to backend API
 func (c *Client) AddReaction(token string, data models.AddReactionData) error {
 	bodyBytes, err := json.Marshal(map[string]interface{}{
@@ -183,21 +330,15 @@ func (c *Client) AddReaction(token string, data models.AddReactionData) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("AddReaction", req)
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		return fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			return fmt.Errorf("backend error: %s", errResp.Error)
-		}
-		return fmt.Errorf("backend error: status %d", resp.StatusCode)
+		return newError(resp.StatusCode, body)
 	}
 
 	return nil
@@ -220,21 +361,47 @@ func (c *Client) MarkAsRead(token string, data models.MarkReadData) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do("MarkAsRead", req)
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		return fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		var errResp struct {
-			Error string `json:"error"`
-		}
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			return fmt.Errorf("backend error: %s", errResp.Error)
-		}
-		return fmt.Errorf("backend error: status %d", resp.StatusCode)
+		return newError(resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// UpdateOnlineStatus reports user's online status to backend API.
+// The backend stores only the status, custom status text stays in the gateway.
+func (c *Client) UpdateOnlineStatus(token string, status string) error {
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("PATCH", c.baseURL+"/api/v1/users/me/status", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.do("UpdateOnlineStatus", req)
+	if err != nil {
+		return fmt.Errorf("do request: %w: %w", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newError(resp.StatusCode, body)
 	}
 
 	return nil
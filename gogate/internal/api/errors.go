@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnavailable is returned when the backend cannot be reached
+var ErrUnavailable = errors.New("backend unavailable")
+
+// Error is returned when the backend responds with a non-success status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("backend error: %s (status %d)", e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("backend error: status %d", e.StatusCode)
+}
+
+// newError builds an Error from a backend error response body.
+// The backend reports errors as {"error": ...} or {"message": ...}.
+func newError(statusCode int, body []byte) *Error {
+	var errResp struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+
+	apiErr := &Error{StatusCode: statusCode}
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		apiErr.Message = errResp.Error
+		if apiErr.Message == "" {
+			apiErr.Message = errResp.Message
+		}
+	}
+	return apiErr
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"buzzchat-gogate/internal/metrics"
+)
+
+// requestMetrics records backend request latency and failures per client method
+type requestMetrics struct {
+	duration *metrics.Histogram
+	errors   *metrics.Counter
+}
+
+// newRequestMetrics registers the backend request metrics
+func newRequestMetrics(reg *metrics.Registry) requestMetrics {
+	return requestMetrics{
+		duration: reg.NewHistogram("gogate_backend_request_duration_seconds",
+			"Time until the Backend API responded, per client method.", metrics.DefBuckets, "method"),
+		errors: reg.NewCounter("gogate_backend_errors_total",
+			"Failed Backend API requests per client method, by HTTP status or unavailable.", "method", "status"),
+	}
+}
+
+// do sends a request, recording its latency and failure under method
+func (c *Client) do(method string, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	c.metrics.duration.Observe(time.Since(start).Seconds(), method)
+
+	switch {
+	case err != nil:
+		c.metrics.errors.Inc(method, "unavailable")
+	case resp.StatusCode >= http.StatusBadRequest:
+		c.metrics.errors.Inc(method, strconv.Itoa(resp.StatusCode))
+	}
+
+	return resp, err
+}
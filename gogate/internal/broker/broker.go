@@ -0,0 +1,67 @@
+// Package broker distributes events between gateway instances, so users
+// connected to different instances receive each other's events.
+package broker
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Envelope kinds
+const (
+	// KindChat delivers an event to all members of ChatID
+	KindChat = "chat"
+
+	// KindUser delivers an event to all connections of UserIDs
+	KindUser = "user"
+
+	// KindDisconnect closes connections of UserIDs (optionally only those
+	// matching SessionID and TokenHash)
+	KindDisconnect = "disconnect"
+
+	// KindPresence announces that UserIDs are connected to Instance (Online)
+	// or no longer are
+	KindPresence = "presence"
+)
+
+// Envelope is a unit of work published to every gateway instance
+type Envelope struct {
+	Kind          string          `json:"kind"`
+	Event         string          `json:"event,omitempty"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	ChatID        int             `json:"chat_id,omitempty"`
+	UserIDs       []int           `json:"user_ids,omitempty"`
+	ExcludeUserID *int            `json:"exclude_user_id,omitempty"`
+	SessionID     string          `json:"session_id,omitempty"`
+	TokenHash     string          `json:"token_hash,omitempty"`
+	Reason        string          `json:"reason,omitempty"`
+	Instance      string          `json:"instance,omitempty"`
+	Online        bool            `json:"online,omitempty"`
+}
+
+// Handler processes an envelope on the receiving instance
+type Handler func(env Envelope)
+
+// Broker publishes envelopes to all gateway instances, including the publishing one
+type Broker interface {
+	// Subscribe sets the handler for received envelopes. It must be called
+	// once, before the first Publish.
+	Subscribe(handler Handler) error
+
+	// Publish sends an envelope to all instances
+	Publish(env Envelope) error
+
+	// Close stops receiving envelopes and releases resources
+	Close() error
+}
+
+// Store keeps short-lived values shared by all gateway instances. Brokers
+// that reach every instance through shared infrastructure implement it.
+type Store interface {
+	// Put stores value under key until ttl elapses
+	Put(key, value string, ttl time.Duration) error
+
+	// Take returns the value of key and deletes it, so only one caller gets
+	// it. ok is false if the key doesn't exist or expired.
+	Take(key string) (value string, ok bool, err error)
+}
@@ -0,0 +1,31 @@
+package broker
+
+// MemoryBroker delivers envelopes within the process only, for a single
+// gateway instance. Publish calls the handler synchronously.
+type MemoryBroker struct {
+	handler Handler
+}
+
+// NewMemoryBroker creates an in-process broker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+// Subscribe sets the handler for published envelopes
+func (b *MemoryBroker) Subscribe(handler Handler) error {
+	b.handler = handler
+	return nil
+}
+
+// Publish hands the envelope to the handler
+func (b *MemoryBroker) Publish(env Envelope) error {
+	if b.handler != nil {
+		b.handler(env)
+	}
+	return nil
+}
+
+// Close does nothing
+func (b *MemoryBroker) Close() error {
+	return nil
+}
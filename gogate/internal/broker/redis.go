@@ -0,0 +1,392 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout    = 5 * time.Second
+	redisWriteTimeout   = 5 * time.Second
+	redisReadTimeout    = 5 * time.Second
+	redisReconnectMin   = 500 * time.Millisecond
+	redisReconnectMax   = 30 * time.Second
+	redisSubscribeReply = "subscribe"
+
+	// redisDispatchQueueSize is the number of received envelopes waiting for
+	// the handler; envelopes arriving while it is full are dropped
+	redisDispatchQueueSize = 4096
+)
+
+// RedisBroker publishes envelopes over Redis pub/sub, speaking RESP directly.
+// Every instance subscribes to the same channel, so a published envelope is
+// delivered to all of them, including the publisher. Messages published while
+// an instance is disconnected from Redis are lost for that instance.
+// Received envelopes are handled in order on a separate goroutine, so a slow
+// handler doesn't stop the subscriber from reading and get it disconnected
+// by Redis' output buffer limit.
+type RedisBroker struct {
+	addr     string
+	password string
+	channel  string
+
+	pubMu sync.Mutex
+	pub   *redisConn
+
+	mu     sync.Mutex
+	sub    *redisConn
+	closed bool
+	done   chan struct{}
+
+	// Received envelopes waiting for the handler
+	queue chan Envelope
+}
+
+// NewRedisBroker creates a broker using the Redis server at addr
+func NewRedisBroker(addr, password, channel string) *RedisBroker {
+	return &RedisBroker{
+		addr:     addr,
+		password: password,
+		channel:  channel,
+		done:     make(chan struct{}),
+		queue:    make(chan Envelope, redisDispatchQueueSize),
+	}
+}
+
+// Subscribe starts receiving envelopes in the background, reconnecting on failure
+func (b *RedisBroker) Subscribe(handler Handler) error {
+	conn, err := b.subscribe()
+	if err != nil {
+		return err
+	}
+	go b.dispatch(handler)
+	go b.receiveLoop(conn)
+	return nil
+}
+
+// Publish sends the envelope to the channel
+func (b *RedisBroker) Publish(env Envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	if _, err := b.command("PUBLISH", b.channel, string(payload)); err != nil {
+		return fmt.Errorf("redis publish failed: %w", err)
+	}
+	return nil
+}
+
+// Put stores value under key with SET ... PX
+func (b *RedisBroker) Put(key, value string, ttl time.Duration) error {
+	if _, err := b.command("SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+		return fmt.Errorf("redis set failed: %w", err)
+	}
+	return nil
+}
+
+// Take returns and deletes the value of key with GETDEL (Redis 6.2+)
+func (b *RedisBroker) Take(key string) (string, bool, error) {
+	reply, err := b.command("GETDEL", key)
+	if err != nil {
+		return "", false, fmt.Errorf("redis getdel failed: %w", err)
+	}
+	value, ok := reply.(string)
+	return value, ok, nil
+}
+
+// command runs a command on the shared publishing connection
+func (b *RedisBroker) command(args ...string) (any, error) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	// Retry once on a fresh connection: the cached one may have gone stale
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if b.pub == nil {
+			if b.pub, err = b.dial(); err != nil {
+				return nil, err
+			}
+		}
+		var reply any
+		if reply, err = b.pub.do(args...); err == nil {
+			return reply, nil
+		}
+		if _, ok := err.(redisError); ok {
+			// The server answered, the connection is fine
+			return nil, err
+		}
+		b.pub.Close()
+		b.pub = nil
+	}
+	return nil, err
+}
+
+// Close stops the subscriber and closes the connections
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.sub != nil {
+		b.sub.Close()
+	}
+	b.mu.Unlock()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub != nil {
+		b.pub.Close()
+		b.pub = nil
+	}
+	return nil
+}
+
+// subscribe opens a connection subscribed to the channel
+func (b *RedisBroker) subscribe() (*redisConn, error) {
+	conn, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do("SUBSCRIBE", b.channel)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if kind, _ := messageParts(reply); kind != redisSubscribeReply {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected subscribe reply: %v", reply)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		conn.Close()
+		return nil, errors.New("broker closed")
+	}
+	b.sub = conn
+	return conn, nil
+}
+
+// dispatch hands queued envelopes to handler in the order they were received
+func (b *RedisBroker) dispatch(handler Handler) {
+	for {
+		select {
+		case env := <-b.queue:
+			handler(env)
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// receiveLoop reads messages from conn and resubscribes when it fails
+func (b *RedisBroker) receiveLoop(conn *redisConn) {
+	backoff := redisReconnectMin
+	for {
+		err := b.receive(conn)
+		conn.Close()
+
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		log.Printf("Redis subscription lost: %v", err)
+
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-time.After(backoff):
+			}
+			if conn, err = b.subscribe(); err == nil {
+				log.Printf("Redis subscription restored")
+				backoff = redisReconnectMin
+				break
+			}
+			log.Printf("Redis resubscribe failed: %v", err)
+			backoff = min(backoff*2, redisReconnectMax)
+		}
+	}
+}
+
+// receive queues every message on conn for dispatch until the connection fails
+func (b *RedisBroker) receive(conn *redisConn) error {
+	for {
+		reply, err := conn.read()
+		if err != nil {
+			return err
+		}
+		kind, payload := messageParts(reply)
+		if kind != "message" {
+			continue
+		}
+
+		var env Envelope
+		if err := json.Unmarshal([]byte(payload), &env); err != nil {
+			log.Printf("Dropping malformed broker envelope: %v", err)
+			continue
+		}
+
+		select {
+		case b.queue <- env:
+		default:
+			log.Printf("Broker dispatch queue full, dropping %s envelope", env.Kind)
+		}
+	}
+}
+
+// dial connects to Redis and authenticates if a password is set
+func (b *RedisBroker) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", b.addr, redisDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis dial failed: %w", err)
+	}
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+
+	if b.password != "" {
+		if _, err := conn.do("AUTH", b.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// messageParts extracts the kind and payload of a pub/sub push.
+// "message" pushes are [message, channel, payload]; others have no payload.
+func messageParts(reply any) (kind, payload string) {
+	parts, ok := reply.([]any)
+	if !ok || len(parts) == 0 {
+		return "", ""
+	}
+	kind, _ = parts[0].(string)
+	if len(parts) == 3 {
+		payload, _ = parts[2].(string)
+	}
+	return kind, payload
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis error: " + string(e)
+}
+
+// redisConn is a minimal RESP client connection
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// do sends a command and reads its reply. The read deadline keeps an
+// unresponsive server from blocking the caller; it is cleared afterwards so
+// the subscriber can wait for pushes indefinitely.
+func (c *redisConn) do(args ...string) (any, error) {
+	if err := c.write(args...); err != nil {
+		return nil, err
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(redisReadTimeout))
+	defer c.conn.SetReadDeadline(time.Time{})
+	return c.read()
+}
+
+// write sends a command as a RESP array of bulk strings
+func (c *redisConn) write(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// read parses one RESP reply. Bulk and simple strings become string,
+// integers int64, arrays []any and nil bulk strings nil.
+func (c *redisConn) read() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown redis reply type %q", line[0])
+}
+
+// readLine reads a CRLF-terminated line without the terminator
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("malformed redis line")
+	}
+	return line[:len(line)-2], nil
+}
+
+// Close closes the network connection
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
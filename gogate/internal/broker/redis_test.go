@@ -0,0 +1,364 @@
+package broker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRedisPassword = "secret"
+
+// fakeRedis is a RESP stand-in implementing AUTH, SUBSCRIBE, PUBLISH, SET
+// (with PX) and GETDEL
+type fakeRedis struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	subs     map[net.Conn]string
+	values   map[string]fakeValue
+	commands []string
+}
+
+// fakeValue is a stored key with its expiry
+type fakeValue struct {
+	value     string
+	expiresAt time.Time
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{
+		ln:     ln,
+		conns:  make(map[net.Conn]bool),
+		subs:   make(map[net.Conn]string),
+		values: make(map[string]fakeValue),
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		f.dropConnections()
+	})
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns[conn] = true
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.ln.Addr().String()
+}
+
+// dropConnections closes every client connection, like a Redis restart
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = make(map[net.Conn]bool)
+	f.subs = make(map[net.Conn]string)
+}
+
+// commandNames returns the names of all commands received so far
+func (f *fakeRedis) commandNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authed := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.ToUpper(args[0]))
+		f.mu.Unlock()
+
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if len(args) == 2 && args[1] == testRedisPassword {
+				authed = true
+				conn.Write([]byte("+OK\r\n"))
+			} else {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+		case "SUBSCRIBE":
+			if !authed {
+				conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+				continue
+			}
+			f.mu.Lock()
+			f.subs[conn] = args[1]
+			f.mu.Unlock()
+			conn.Write([]byte("*3\r\n" + bulk("subscribe") + bulk(args[1]) + ":1\r\n"))
+		case "PUBLISH":
+			if !authed {
+				conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+				continue
+			}
+			f.mu.Lock()
+			receivers := 0
+			for sub, channel := range f.subs {
+				if channel == args[1] {
+					sub.Write([]byte("*3\r\n" + bulk("message") + bulk(args[1]) + bulk(args[2])))
+					receivers++
+				}
+			}
+			f.mu.Unlock()
+			fmt.Fprintf(conn, ":%d\r\n", receivers)
+		case "SET":
+			if len(args) != 5 || strings.ToUpper(args[3]) != "PX" {
+				conn.Write([]byte("-ERR syntax error\r\n"))
+				continue
+			}
+			ms, _ := strconv.Atoi(args[4])
+			f.mu.Lock()
+			f.values[args[1]] = fakeValue{
+				value:     args[2],
+				expiresAt: time.Now().Add(time.Duration(ms) * time.Millisecond),
+			}
+			f.mu.Unlock()
+			conn.Write([]byte("+OK\r\n"))
+		case "GETDEL":
+			f.mu.Lock()
+			v, ok := f.values[args[1]]
+			delete(f.values, args[1])
+			f.mu.Unlock()
+			if !ok || time.Now().After(v.expiresAt) {
+				conn.Write([]byte("$-1\r\n"))
+				continue
+			}
+			conn.Write([]byte(bulk(v.value)))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+// subscribeBroker creates a broker subscribed to the fake server, passing
+// received envelopes to the returned channel
+func subscribeBroker(t *testing.T, f *fakeRedis) (*RedisBroker, chan Envelope) {
+	t.Helper()
+
+	b := NewRedisBroker(f.addr(), testRedisPassword, "events")
+	received := make(chan Envelope, 16)
+	if err := b.Subscribe(func(env Envelope) { received <- env }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, received
+}
+
+func expectEnvelope(t *testing.T, received chan Envelope, want Envelope) {
+	t.Helper()
+
+	select {
+	case got := <-received:
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("got envelope %s, want %s", gotJSON, wantJSON)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for envelope")
+	}
+}
+
+func TestRedisBrokerSubscribe(t *testing.T) {
+	f := newFakeRedis(t)
+	subscribeBroker(t, f)
+
+	got := strings.Join(f.commandNames(), ",")
+	if got != "AUTH,SUBSCRIBE" {
+		t.Errorf("got commands %s, want AUTH,SUBSCRIBE", got)
+	}
+}
+
+func TestRedisBrokerPublish(t *testing.T) {
+	f := newFakeRedis(t)
+	a, receivedA := subscribeBroker(t, f)
+	_, receivedB := subscribeBroker(t, f)
+
+	exclude := 3
+	env := Envelope{
+		Kind:          KindChat,
+		Event:         "new_message",
+		Data:          json.RawMessage(`{"id":5,"text":"hi"}`),
+		ChatID:        1,
+		ExcludeUserID: &exclude,
+	}
+	if err := a.Publish(env); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	// Every instance receives the envelope, including the publisher
+	expectEnvelope(t, receivedA, env)
+	expectEnvelope(t, receivedB, env)
+}
+
+func TestRedisBrokerSlowHandler(t *testing.T) {
+	f := newFakeRedis(t)
+	b := NewRedisBroker(f.addr(), testRedisPassword, "events")
+	defer b.Close()
+
+	release := make(chan struct{})
+	received := make(chan Envelope, 16)
+	if err := b.Subscribe(func(env Envelope) {
+		<-release
+		received <- env
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	for userID := 1; userID <= 3; userID++ {
+		if err := b.Publish(Envelope{Kind: KindUser, UserIDs: []int{userID}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	// The read loop keeps queueing while the handler is blocked
+	deadline := time.Now().Add(2 * time.Second)
+	for len(b.queue) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queued %d envelopes while the handler was blocked, want 2", len(b.queue))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	for userID := 1; userID <= 3; userID++ {
+		expectEnvelope(t, received, Envelope{Kind: KindUser, UserIDs: []int{userID}})
+	}
+}
+
+func TestRedisBrokerStore(t *testing.T) {
+	f := newFakeRedis(t)
+	a := NewRedisBroker(f.addr(), testRedisPassword, "events")
+	defer a.Close()
+	b := NewRedisBroker(f.addr(), testRedisPassword, "events")
+	defer b.Close()
+
+	if err := a.Put("ticket:1", "payload", time.Minute); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// Any instance can take the value, but only once
+	value, ok, err := b.Take("ticket:1")
+	if err != nil || !ok || value != "payload" {
+		t.Fatalf("Take = %q, %v, %v, want payload", value, ok, err)
+	}
+	if _, ok, err := a.Take("ticket:1"); err != nil || ok {
+		t.Errorf("second Take = %v, %v, want not found", ok, err)
+	}
+
+	if err := a.Put("ticket:2", "payload", time.Millisecond); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, ok, err := b.Take("ticket:2"); err != nil || ok {
+		t.Errorf("Take of expired key = %v, %v, want not found", ok, err)
+	}
+}
+
+func TestRedisBrokerAuthFailure(t *testing.T) {
+	f := newFakeRedis(t)
+	b := NewRedisBroker(f.addr(), "wrong", "events")
+	defer b.Close()
+
+	err := b.Subscribe(func(Envelope) {})
+	if err == nil || !strings.Contains(err.Error(), "redis auth failed") {
+		t.Errorf("Subscribe error = %v, want auth failure", err)
+	}
+	if err := b.Publish(Envelope{Kind: KindUser}); err == nil {
+		t.Error("Publish succeeded with a wrong password")
+	}
+}
+
+func TestRedisBrokerResubscribe(t *testing.T) {
+	f := newFakeRedis(t)
+	b, received := subscribeBroker(t, f)
+
+	if err := b.Publish(Envelope{Kind: KindUser, UserIDs: []int{1}}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	expectEnvelope(t, received, Envelope{Kind: KindUser, UserIDs: []int{1}})
+
+	f.dropConnections()
+
+	// Envelopes published before the subscriber is back are lost, so keep
+	// publishing until one arrives. Publish itself must recover the stale
+	// connection on its own.
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := b.Publish(Envelope{Kind: KindUser, UserIDs: []int{2}}); err != nil {
+			t.Fatalf("Publish after reconnect failed: %v", err)
+		}
+		select {
+		case env := <-received:
+			if len(env.UserIDs) != 1 || env.UserIDs[0] != 2 {
+				t.Fatalf("got envelope for users %v, want [2]", env.UserIDs)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("subscription was not restored")
+		}
+	}
+}
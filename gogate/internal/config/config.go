@@ -4,6 +4,31 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+)
+
+// Send queue overflow policies
+const (
+	// OverflowDrop drops the message when a connection's send buffer is full
+	OverflowDrop = "drop"
+
+	// OverflowDisconnect closes a connection whose send buffer is full
+	OverflowDisconnect = "disconnect"
+)
+
+// Brokers distributing events between gateway instances
+const (
+	// BrokerMemory delivers events within a single instance
+	BrokerMemory = "memory"
+
+	// BrokerRedis distributes events over Redis pub/sub
+	BrokerRedis = "redis"
+)
+
+// Default inbound event rate limits (event:rate:burst, see ParseRateLimits)
+const (
+	defaultConnRateLimits = "*:20:40,send_message:5:10,typing:2:5"
+	defaultUserRateLimits = "*:40:80,send_message:10:20"
 )
 
 type Config struct {
@@ -11,29 +36,132 @@ type Config struct {
 	Port string
 
 	// Backend API settings
-	BackendAPIURL    string
-	InternalAPIKey   string
+	BackendAPIURL  string
+	InternalAPIKey string
 
 	// WebSocket settings
-	MaxMessageSize   int64
-	ReadBufferSize   int
-	WriteBufferSize  int
-	PingPeriod       int // seconds
-	PongWait         int // seconds
-	WriteWait        int // seconds
+	MaxMessageSize  int64
+	ReadBufferSize  int
+	WriteBufferSize int
+	PingPeriod      int // seconds
+	PongWait        int // seconds
+	WriteWait       int // seconds
+
+	// Per-connection send queue
+	SendBufferSize      int    // messages
+	SendOverflowPolicy  string // OverflowDrop or OverflowDisconnect, for durable events
+	EphemeralBufferSize int    // messages, oldest dropped when full
+
+	// Time allowed to send the auth event after connecting
+	AuthTimeout int // seconds
+
+	// Time before token expiry to send token_expiring
+	TokenExpiryWarning int // seconds
+
+	// Inbound event rate limits per connection and per user
+	ConnRateLimits RateLimits
+	UserRateLimits RateLimits
+
+	// Rate limit violations within RateLimitWindow before disconnecting (0 disables)
+	RateLimitMaxViolations int
+	RateLimitWindow        int // seconds
+
+	// Typing indicators: minimum interval between broadcasts per user and chat,
+	// and time after the last typing event before is_typing:false is sent
+	TypingThrottle int // seconds
+	TypingTimeout  int // seconds
+
+	// Per-user log of durable events replayed on resume
+	EventLogSize int // events
+	EventLogTTL  int // seconds
+
+	// Event distribution between gateway instances
+	Broker        string // BrokerMemory or BrokerRedis
+	RedisAddr     string
+	RedisPassword string
+	RedisChannel  string
+
+	// Lifetime of single-use connection tickets
+	TicketTTL int // seconds
+
+	// Browser origins allowed to open WebSocket connections
+	AllowedOrigins []string
+
+	// Development mode: allows any origin
+	DevMode bool
+
+	// Chat member cache TTL (0 disables caching)
+	MemberCacheTTL int // seconds
+
+	// Subscribe new connections to all chats of their user, until the
+	// client sends subscribe or unsubscribe itself
+	AutoSubscribe bool
+
+	// Report online/offline status changes to backend
+	PresenceReport bool
+
+	// Idle period before an available user becomes away (0 disables)
+	AutoAwayAfter int // seconds
+
+	// Serve Prometheus metrics at /metrics
+	MetricsEnabled bool
+
+	// Graceful shutdown settings
+	ShutdownTimeout int // seconds
+	ReconnectDelay  int // seconds, hint sent to clients
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
-		Port:             getEnv("PORT", "8080"),
-		BackendAPIURL:    getEnv("BACKEND_API_URL", "http://localhost:8000"),
-		InternalAPIKey:   getEnv("INTERNAL_API_KEY", ""),
-		MaxMessageSize:   getEnvInt64("MAX_MESSAGE_SIZE", 512000), // 500KB
-		ReadBufferSize:   getEnvInt("READ_BUFFER_SIZE", 1024),
-		WriteBufferSize:  getEnvInt("WRITE_BUFFER_SIZE", 1024),
-		PingPeriod:       getEnvInt("PING_PERIOD", 54),  // 54 seconds
-		PongWait:         getEnvInt("PONG_WAIT", 60),    // 60 seconds
-		WriteWait:        getEnvInt("WRITE_WAIT", 10),   // 10 seconds
+		Port:               getEnv("PORT", "8080"),
+		BackendAPIURL:      getEnv("BACKEND_API_URL", "http://localhost:8000"),
+		InternalAPIKey:     getEnv("INTERNAL_API_KEY", ""),
+		MaxMessageSize:     getEnvInt64("MAX_MESSAGE_SIZE", 512000), // 500KB
+		ReadBufferSize:     getEnvInt("READ_BUFFER_SIZE", 1024),
+		WriteBufferSize:    getEnvInt("WRITE_BUFFER_SIZE", 1024),
+		PingPeriod:         getEnvInt("PING_PERIOD", 54), // 54 seconds
+		PongWait:           getEnvInt("PONG_WAIT", 60),   // 60 seconds
+		WriteWait:          getEnvInt("WRITE_WAIT", 10),  // 10 seconds
+		SendBufferSize:     getEnvInt("SEND_BUFFER_SIZE", 256),
+		SendOverflowPolicy: getEnv("SEND_OVERFLOW_POLICY", OverflowDisconnect),
+		AuthTimeout:        getEnvInt("AUTH_TIMEOUT", 10),         // 10 seconds
+		TokenExpiryWarning: getEnvInt("TOKEN_EXPIRY_WARNING", 60), // 60 seconds
+		TicketTTL:          getEnvInt("TICKET_TTL", 30),           // 30 seconds
+		AllowedOrigins:     getEnvList("ALLOWED_ORIGINS"),
+		DevMode:            getEnvBool("DEV_MODE", false),
+		MemberCacheTTL:     getEnvInt("MEMBER_CACHE_TTL", 30), // 30 seconds
+		PresenceReport:     getEnvBool("PRESENCE_REPORT", true),
+		AutoAwayAfter:      getEnvInt("AUTO_AWAY_AFTER", 300), // 5 minutes
+		ShutdownTimeout:    getEnvInt("SHUTDOWN_TIMEOUT", 15), // 15 seconds
+		ReconnectDelay:     getEnvInt("RECONNECT_DELAY", 5),   // 5 seconds
+
+		EphemeralBufferSize: getEnvInt("EPHEMERAL_BUFFER_SIZE", 32),
+
+		RateLimitMaxViolations: getEnvInt("RATE_LIMIT_MAX_VIOLATIONS", 20),
+		RateLimitWindow:        getEnvInt("RATE_LIMIT_WINDOW", 10), // 10 seconds
+
+		TypingThrottle: getEnvInt("TYPING_THROTTLE", 3), // 3 seconds
+		TypingTimeout:  getEnvInt("TYPING_TIMEOUT", 6),  // 6 seconds
+
+		EventLogSize: getEnvInt("EVENT_LOG_SIZE", 200),
+		EventLogTTL:  getEnvInt("EVENT_LOG_TTL", 300), // 5 minutes
+
+		Broker:        getEnv("BROKER", BrokerMemory),
+		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		RedisChannel:  getEnv("REDIS_CHANNEL", "gogate:events"),
+
+		AutoSubscribe: getEnvBool("AUTO_SUBSCRIBE", true),
+
+		MetricsEnabled: getEnvBool("METRICS_ENABLED", true),
+	}
+
+	var err error
+	if cfg.ConnRateLimits, err = ParseRateLimits(getEnvAllowEmpty("RATE_LIMIT_CONN", defaultConnRateLimits)); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_CONN: %w", err)
+	}
+	if cfg.UserRateLimits, err = ParseRateLimits(getEnvAllowEmpty("RATE_LIMIT_USER", defaultUserRateLimits)); err != nil {
+		return nil, fmt.Errorf("RATE_LIMIT_USER: %w", err)
 	}
 
 	// Validate required fields
@@ -41,9 +169,61 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("INTERNAL_API_KEY is required")
 	}
 
+	if len(cfg.AllowedOrigins) == 0 && !cfg.DevMode {
+		return nil, fmt.Errorf("ALLOWED_ORIGINS is required unless DEV_MODE=true")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
+// Validate checks WebSocket settings for consistency
+func (c *Config) Validate() error {
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("MAX_MESSAGE_SIZE must be positive")
+	}
+	if c.ReadBufferSize <= 0 || c.WriteBufferSize <= 0 {
+		return fmt.Errorf("READ_BUFFER_SIZE and WRITE_BUFFER_SIZE must be positive")
+	}
+	if c.PingPeriod <= 0 || c.PongWait <= 0 || c.WriteWait <= 0 {
+		return fmt.Errorf("PING_PERIOD, PONG_WAIT and WRITE_WAIT must be positive")
+	}
+	if c.PingPeriod >= c.PongWait {
+		return fmt.Errorf("PING_PERIOD (%d) must be less than PONG_WAIT (%d)", c.PingPeriod, c.PongWait)
+	}
+	if c.SendBufferSize <= 0 || c.EphemeralBufferSize <= 0 {
+		return fmt.Errorf("SEND_BUFFER_SIZE and EPHEMERAL_BUFFER_SIZE must be positive")
+	}
+	if c.TokenExpiryWarning < 0 {
+		return fmt.Errorf("TOKEN_EXPIRY_WARNING must not be negative")
+	}
+	if c.RateLimitMaxViolations < 0 {
+		return fmt.Errorf("RATE_LIMIT_MAX_VIOLATIONS must not be negative")
+	}
+	if c.RateLimitMaxViolations > 0 && c.RateLimitWindow <= 0 {
+		return fmt.Errorf("RATE_LIMIT_WINDOW must be positive")
+	}
+	if c.TypingThrottle < 0 || c.TypingTimeout <= 0 {
+		return fmt.Errorf("TYPING_THROTTLE must not be negative and TYPING_TIMEOUT must be positive")
+	}
+	if c.EventLogSize <= 0 || c.EventLogTTL <= 0 {
+		return fmt.Errorf("EVENT_LOG_SIZE and EVENT_LOG_TTL must be positive")
+	}
+	if c.TicketTTL <= 0 {
+		return fmt.Errorf("TICKET_TTL must be positive")
+	}
+	if c.SendOverflowPolicy != OverflowDrop && c.SendOverflowPolicy != OverflowDisconnect {
+		return fmt.Errorf("SEND_OVERFLOW_POLICY must be %q or %q", OverflowDrop, OverflowDisconnect)
+	}
+	if c.Broker != BrokerMemory && c.Broker != BrokerRedis {
+		return fmt.Errorf("BROKER must be %q or %q", BrokerMemory, BrokerRedis)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -51,6 +231,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAllowEmpty is like getEnv, but a variable set to an empty value
+// returns the empty value
+func getEnvAllowEmpty(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intVal, err := strconv.Atoi(value); err == nil {
@@ -68,3 +257,22 @@ func getEnvInt64(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RateLimitDefault is the event name matching events without their own limit
+const RateLimitDefault = "*"
+
+// RateLimit is a token bucket: Rate events per second with bursts of up to Burst events
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits maps event names (or RateLimitDefault) to their limits
+type RateLimits map[string]RateLimit
+
+// For returns the limit for an event and the name it is configured under,
+// falling back to the default limit
+func (l RateLimits) For(event string) (string, RateLimit, bool) {
+	if limit, ok := l[event]; ok {
+		return event, limit, true
+	}
+	limit, ok := l[RateLimitDefault]
+	return RateLimitDefault, limit, ok
+}
+
+// ParseRateLimits parses a comma-separated list of event:rate:burst entries,
+// e.g. "send_message:5:10,typing:2:5,*:20:40". An empty spec disables limiting.
+func ParseRateLimits(spec string) (RateLimits, error) {
+	limits := make(RateLimits)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid rate limit %q: want event:rate:burst", entry)
+		}
+
+		rate, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: rate must be a positive number", entry)
+		}
+
+		burst, err := strconv.Atoi(parts[2])
+		if err != nil || burst <= 0 {
+			return nil, fmt.Errorf("invalid rate limit %q: burst must be a positive integer", entry)
+		}
+
+		limits[parts[0]] = RateLimit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
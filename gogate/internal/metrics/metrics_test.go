@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape serves the registry through httptest and returns the response body
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+
+	server := httptest.NewServer(reg)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("got Content-Type %q", got)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading scrape failed: %v", err)
+	}
+	return string(body)
+}
+
+func TestCounter(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounter("test_events_total", "Events handled.", "event")
+	counter.Inc("send_message")
+	counter.Inc("send_message")
+	counter.Add(3, "typing")
+
+	want := `# HELP test_events_total Events handled.
+# TYPE test_events_total counter
+test_events_total{event="send_message"} 2
+test_events_total{event="typing"} 3
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	reg := NewRegistry()
+	histogram := reg.NewHistogram("test_duration_seconds", "Request duration.", []float64{1, 0.1}, "method")
+	histogram.Observe(0.05, "Get")
+	histogram.Observe(0.1, "Get")
+	histogram.Observe(0.5, "Get")
+	histogram.Observe(2, "Get")
+
+	// Buckets are sorted, cumulative and include values equal to the bound
+	want := `# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="Get",le="0.1"} 2
+test_duration_seconds_bucket{method="Get",le="1"} 3
+test_duration_seconds_bucket{method="Get",le="+Inf"} 4
+test_duration_seconds_sum{method="Get"} 2.65
+test_duration_seconds_count{method="Get"} 4
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFuncMetrics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewGaugeFunc("test_connections", "Open connections.", func() float64 { return 7 })
+	reg.NewCounterFunc("test_dropped_total", "Dropped messages.", "event", func() map[string]float64 {
+		return map[string]float64{"user_typing": 4, "new_message": 1}
+	})
+
+	want := `# HELP test_connections Open connections.
+# TYPE test_connections gauge
+test_connections 7
+# HELP test_dropped_total Dropped messages.
+# TYPE test_dropped_total counter
+test_dropped_total{event="new_message"} 1
+test_dropped_total{event="user_typing"} 4
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounter("test_escaped_total", "Help with \\ and\nnewline.", "value")
+	counter.Inc("quote \" backslash \\ newline \n end")
+
+	want := `# HELP test_escaped_total Help with \\ and\nnewline.
+# TYPE test_escaped_total counter
+test_escaped_total{value="quote \" backslash \\ newline \n end"} 1
+`
+	if got := scrape(t, reg); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice didn't panic")
+		}
+	}()
+	reg.NewGaugeFunc("test_total", "Test.", func() float64 { return 0 })
+}
+
+func TestEmptyRegistry(t *testing.T) {
+	if got := scrape(t, NewRegistry()); strings.TrimSpace(got) != "" {
+		t.Errorf("got %q for an empty registry", got)
+	}
+}
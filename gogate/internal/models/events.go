@@ -5,23 +5,106 @@ import "encoding/json"
 // Event types
 const (
 	// Client -> Server
-	EventAuth         = "auth"
-	EventSendMessage  = "send_message"
-	EventTyping       = "typing"
-	EventAddReaction  = "add_reaction"
-	EventMarkRead     = "mark_read"
+	EventAuth          = "auth"
+	EventSendMessage   = "send_message"
+	EventTyping        = "typing"
+	EventAddReaction   = "add_reaction"
+	EventMarkRead      = "mark_read"
+	EventEditMessage   = "edit_message"
+	EventDeleteMessage = "delete_message"
+	EventGetPresence   = "get_presence"
+	EventSetStatus     = "set_status"
+	EventReauth        = "reauth"
+	EventResume        = "resume"
+	EventSubscribe     = "subscribe"
+	EventUnsubscribe   = "unsubscribe"
 
 	// Server -> Client
-	EventAuthSuccess  = "auth_success"
-	EventNewMessage   = "new_message"
-	EventUserTyping   = "user_typing"
-	EventNewReaction  = "new_reaction"
-	EventMessageRead  = "message_read"
-	EventError        = "error"
+	EventAuthSuccess     = "auth_success"
+	EventNewMessage      = "new_message"
+	EventUserTyping      = "user_typing"
+	EventNewReaction     = "new_reaction"
+	EventMessageRead     = "message_read"
+	EventMessageEdited   = "message_edited"
+	EventMessageDeleted  = "message_deleted"
+	EventPresenceChanged = "presence_changed"
+	EventPresence        = "presence"
+	EventAck             = "ack"
+	EventServerShutdown  = "server_shutdown"
+	EventTokenExpiring   = "token_expiring"
+	EventReauthSuccess   = "reauth_success"
+	EventSessionRevoked  = "session_revoked"
+	EventResyncRequired  = "resync_required"
+	EventError           = "error"
+
+	// Membership changes pushed by the backend (invalidate cached chat members)
+	EventMembersAdded  = "members_added"
+	EventMemberRemoved = "member_removed"
+	EventMemberLeft    = "member_left"
+	EventChatDeleted   = "chat_deleted"
+)
+
+// Application close codes (4000-4999)
+const (
+	// Connection did not authenticate in time
+	CloseAuthTimeout = 4001
+
+	// Access token expired without a reauth
+	CloseTokenExpired = 4002
+
+	// Session revoked by the backend (logout, deactivation)
+	CloseSessionRevoked = 4003
 )
 
-// WebSocketMessage is the base message structure
+// Online statuses (mirror backend OnlineStatus)
+const (
+	StatusAvailable = "available"
+	StatusBusy      = "busy"
+	StatusAway      = "away"
+	StatusOffline   = "offline"
+)
+
+// IsValidStatus reports whether status is a known online status
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusAvailable, StatusBusy, StatusAway, StatusOffline:
+		return true
+	}
+	return false
+}
+
+// IsClientEvent reports whether an event may be sent by clients
+func IsClientEvent(event string) bool {
+	switch event {
+	case EventAuth, EventSendMessage, EventTyping, EventAddReaction, EventMarkRead,
+		EventEditMessage, EventDeleteMessage, EventGetPresence, EventSetStatus,
+		EventReauth, EventResume, EventSubscribe, EventUnsubscribe:
+		return true
+	}
+	return false
+}
+
+// IsEphemeralEvent reports whether an event may be dropped for slow clients.
+// Ephemeral events are superseded by later ones and are not worth a disconnect.
+func IsEphemeralEvent(event string) bool {
+	return event == EventUserTyping
+}
+
+// IsMembershipEvent reports whether an event changes chat membership
+func IsMembershipEvent(event string) bool {
+	switch event {
+	case EventMembersAdded, EventMemberRemoved, EventMemberLeft, EventChatDeleted:
+		return true
+	}
+	return false
+}
+
+// WebSocketMessage is the base message structure.
+// ID is optional; when a client sets it, acks and errors echo it back.
+// Seq numbers durable events sent to a user, for resume.
 type WebSocketMessage struct {
+	ID    string          `json:"id,omitempty"`
+	Seq   uint64          `json:"seq,omitempty"`
 	Event string          `json:"event"`
 	Data  json.RawMessage `json:"data,omitempty"`
 }
@@ -32,23 +115,84 @@ type AuthData struct {
 }
 
 type AuthSuccessData struct {
-	UserID int    `json:"user_id"`
-	Name   string `json:"name"`
-	Phone  string `json:"phone"`
+	UserID    int    `json:"user_id"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone"`
+	SessionID string `json:"session_id"`
+	Epoch     string `json:"epoch"`                // event log epoch, for resume
+	ExpiresAt int64  `json:"expires_at,omitempty"` // token expiry, unix seconds
+}
+
+// Resume event data (replays events missed while disconnected)
+type ResumeData struct {
+	Epoch   string `json:"epoch"`
+	LastSeq uint64 `json:"last_seq"`
+}
+
+type ResumeResult struct {
+	Replayed int `json:"replayed"`
+}
+
+// Sent when missed events can't be replayed; the client should reload its state
+type ResyncRequiredData struct {
+	Reason string `json:"reason"`
+}
+
+// Subscribe and unsubscribe event data
+type SubscribeData struct {
+	ChatIDs []int `json:"chat_ids"`
+}
+
+// Result of subscribe and unsubscribe: all chats the connection is subscribed to
+type SubscriptionsResult struct {
+	ChatIDs []int `json:"chat_ids"`
+	Denied  []int `json:"denied,omitempty"` // requested chats the user is not a member of
+}
+
+// Reauth event data (swaps the token of an authenticated connection)
+type ReauthData struct {
+	Token string `json:"token"`
+}
+
+type ReauthSuccessData struct {
+	ExpiresAt int64 `json:"expires_at,omitempty"` // unix seconds
+}
+
+// Sent ahead of token expiry; the client should refresh and send reauth
+type TokenExpiringData struct {
+	ExpiresAt int64 `json:"expires_at"` // unix seconds
+	ExpiresIn int   `json:"expires_in"` // seconds
 }
 
 // Send message event data
 type SendMessageData struct {
-	ChatID        int   `json:"chat_id"`
+	ChatID        int    `json:"chat_id"`
 	Text          string `json:"text,omitempty"`
-	ReplyToID     *int  `json:"reply_to_id,omitempty"`
-	AttachmentIDs []int `json:"attachment_ids,omitempty"`
+	ReplyToID     *int   `json:"reply_to_id,omitempty"`
+	AttachmentIDs []int  `json:"attachment_ids,omitempty"`
+}
+
+// Edit message event data
+type EditMessageData struct {
+	MessageID int    `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+// Delete message event data
+type DeleteMessageData struct {
+	MessageID int `json:"message_id"`
+}
+
+type MessageDeletedData struct {
+	ChatID    int `json:"chat_id"`
+	MessageID int `json:"message_id"`
+	UserID    int `json:"user_id"`
 }
 
 // Typing event data
 type TypingData struct {
-	ChatID    int  `json:"chat_id"`
-	IsTyping  bool `json:"is_typing"`
+	ChatID   int  `json:"chat_id"`
+	IsTyping bool `json:"is_typing"`
 }
 
 type UserTypingData struct {
@@ -65,6 +209,7 @@ type AddReactionData struct {
 }
 
 type NewReactionData struct {
+	ChatID    int    `json:"chat_id"`
 	MessageID int    `json:"message_id"`
 	UserID    int    `json:"user_id"`
 	Name      string `json:"name"`
@@ -77,27 +222,120 @@ type MarkReadData struct {
 }
 
 type MessageReadData struct {
-	MessageIDs []int `json:"message_ids"`
-	UserID     int   `json:"user_id"`
+	ChatID     int    `json:"chat_id"`
+	MessageIDs []int  `json:"message_ids"`
+	UserID     int    `json:"user_id"`
 	Name       string `json:"name"`
 }
 
+// Presence event data
+type PresenceData struct {
+	UserID     int    `json:"user_id"`
+	Status     string `json:"status"`
+	CustomText string `json:"custom_text,omitempty"`
+}
+
+type SetStatusData struct {
+	Status     string `json:"status"`
+	CustomText string `json:"custom_text,omitempty"`
+}
+
+type GetPresenceData struct {
+	UserIDs []int `json:"user_ids"`
+}
+
+type PresenceListData struct {
+	Users []PresenceData `json:"users"`
+}
+
+// Ack event data
+type AckData struct {
+	Event  string          `json:"event"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// Server shutdown event data
+type ServerShutdownData struct {
+	Reason string `json:"reason"`
+
+	// Seconds the client should wait before reconnecting
+	ReconnectAfter int `json:"reconnect_after"`
+}
+
+// Error codes sent in ErrorData.Code
+const (
+	ErrCodeAuthRequired       = "AUTH_REQUIRED"
+	ErrCodeAuthFailed         = "AUTH_FAILED"
+	ErrCodeInvalidPayload     = "INVALID_PAYLOAD"
+	ErrCodeUnknownEvent       = "UNKNOWN_EVENT"
+	ErrCodeNotAMember         = "NOT_A_MEMBER"
+	ErrCodeForbidden          = "FORBIDDEN"
+	ErrCodeNotFound           = "NOT_FOUND"
+	ErrCodeRateLimited        = "RATE_LIMITED"
+	ErrCodeBackendUnavailable = "BACKEND_UNAVAILABLE"
+	ErrCodeBackendError       = "BACKEND_ERROR"
+	ErrCodeInternal           = "INTERNAL_ERROR"
+	ErrCodeShuttingDown       = "SHUTTING_DOWN"
+
+	// auth sent on an authenticated connection (use reauth)
+	ErrCodeAlreadyAuthenticated = "ALREADY_AUTHENTICATED"
+)
+
 // Error event data
 type ErrorData struct {
 	Message string `json:"message"`
 	Code    string `json:"code,omitempty"`
+
+	// HTTP status returned by the backend, if the error came from it
+	Status int `json:"status,omitempty"`
+
+	// Time to wait before retrying a RATE_LIMITED event
+	RetryAfterMs int `json:"retry_after_ms,omitempty"`
+}
+
+// PushRequest is sent by the backend to publish an event through the gateway.
+// Exactly one of ChatID or UserIDs must be set.
+type PushRequest struct {
+	Event         string          `json:"event"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	ChatID        int             `json:"chat_id,omitempty"`
+	UserIDs       []int           `json:"user_ids,omitempty"`
+	ExcludeUserID *int            `json:"exclude_user_id,omitempty"`
+}
+
+// TicketResponse is returned by the ticket endpoint
+type TicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"` // seconds
+}
+
+// SessionRevokedData is sent before a connection is force-closed
+type SessionRevokedData struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// DisconnectRequest is sent by the backend to close a user's connections.
+// Token (an access token the backend issued, e.g. the one being logged out)
+// and SessionID (from auth_success) narrow down the connections; without
+// them all connections of the user are closed.
+type DisconnectRequest struct {
+	UserID    int    `json:"user_id"`
+	Token     string `json:"token,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 // User represents authenticated user
 type User struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Phone    string `json:"phone"`
-	Active   bool   `json:"active"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone"`
+	Active bool   `json:"active"`
 }
 
-// ChatMember represents a member of a chat
+// ChatMember represents a member of a chat, as returned by the internal
+// chat members endpoint
 type ChatMember struct {
-	UserID int    `json:"user_id"`
-	Name   string `json:"name"`
+	UserID int    `json:"id"`
+	Name   string `json:"full_name"`
 }
@@ -1,69 +1,243 @@
 package ws
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"buzzchat-gogate/internal/config"
 	"buzzchat-gogate/internal/models"
 
 	"github.com/gorilla/websocket"
 )
 
-const (
+// connSettings holds per-connection WebSocket settings derived from config
+type connSettings struct {
 	// Time allowed to write a message to the peer
-	writeWait = 10 * time.Second
+	writeWait time.Duration
 
 	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
+	pongWait time.Duration
 
 	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = 54 * time.Second
+	pingPeriod time.Duration
 
 	// Maximum message size allowed from peer
-	maxMessageSize = 512000 // 500KB
-)
+	maxMessageSize int64
+
+	// Capacity of the outbound message queue
+	sendBufferSize int
+
+	// Capacity of the drop-oldest queue for ephemeral events
+	ephemeralSize int
+
+	// Time allowed to authenticate with the auth event (0 disables)
+	authTimeout time.Duration
+
+	// What to do when the outbound queue is full of durable events
+	overflowPolicy string
+
+	// Time before token expiry to send token_expiring
+	expiryWarning time.Duration
+
+	// Inbound event rate limits of a single connection
+	rateLimits config.RateLimits
+
+	// Rate limit violations per window before disconnecting (0 disables)
+	maxViolations   int
+	violationWindow time.Duration
+}
+
+// newConnSettings derives connection settings from config
+func newConnSettings(cfg *config.Config) connSettings {
+	return connSettings{
+		writeWait:      time.Duration(cfg.WriteWait) * time.Second,
+		pongWait:       time.Duration(cfg.PongWait) * time.Second,
+		pingPeriod:     time.Duration(cfg.PingPeriod) * time.Second,
+		maxMessageSize: cfg.MaxMessageSize,
+		sendBufferSize: cfg.SendBufferSize,
+		ephemeralSize:  cfg.EphemeralBufferSize,
+		authTimeout:    time.Duration(cfg.AuthTimeout) * time.Second,
+		overflowPolicy: cfg.SendOverflowPolicy,
+		expiryWarning:  time.Duration(cfg.TokenExpiryWarning) * time.Second,
+
+		rateLimits:      cfg.ConnRateLimits,
+		maxViolations:   cfg.RateLimitMaxViolations,
+		violationWindow: time.Duration(cfg.RateLimitWindow) * time.Second,
+	}
+}
 
 // Connection represents a WebSocket connection
 type Connection struct {
 	// The websocket connection
 	ws *websocket.Conn
 
-	// Buffered channel of outbound messages
-	send chan []byte
+	// Buffered channel of outbound durable messages
+	send chan outbound
+
+	// Outbound ephemeral messages, dropped oldest-first when full
+	ephemeral *ephemeralQueue
 
 	// Hub reference
 	hub *Hub
 
+	// Frame encoding of outbound messages (framingSingle or framingBatch)
+	framing string
+
+	// Random ID identifying this connection (session) to the backend
+	sessionID string
+
+	// WebSocket settings
+	settings connSettings
+
 	// Authenticated user (nil until auth succeeds)
 	user *models.User
 
 	// JWT token for backend API calls
 	token string
 
+	// Token expiry (zero if unknown) and the timers acting on it
+	expiresAt    time.Time
+	expiryTimers []*time.Timer
+
 	// Mutex for thread-safe user assignment
 	mu sync.RWMutex
 
 	// Connection closed flag
 	closed bool
+
+	// Close frame sent once the send queue is drained (0 sends an empty close frame)
+	closeCode   int
+	closeReason string
+
+	// Time of the last inbound frame (unix nanoseconds)
+	lastActivity atomic.Int64
+
+	// Closed once the hub registered the connection, or skipped it because
+	// the connection closed first
+	registered chan struct{}
+
+	// Last event log sequence number at registration; later events are
+	// delivered live, earlier ones only by resume
+	liveFrom uint64
+
+	// Chats subscribed to on registration (auto-subscribe)
+	initialChats []int
+
+	// Subscribed chat IDs with the last event log sequence number before
+	// subscribing; later events of the chat are delivered live, earlier ones
+	// only by resume. Guarded by hub.mu
+	chats map[int]uint64
+
+	// Set once the client sent subscribe or unsubscribe, which stops
+	// automatic subscriptions; guarded by hub.mu
+	manualSubscriptions bool
+
+	// Inbound rate limiting, used only by the read pump
+	limiter    *rateLimiter
+	violations violationCounter
 }
 
-// NewConnection creates a new connection
-func NewConnection(ws *websocket.Conn, hub *Hub) *Connection {
-	return &Connection{
-		ws:   ws,
-		send: make(chan []byte, 256),
-		hub:  hub,
+// NewConnection creates a new connection using the given framing
+func NewConnection(ws *websocket.Conn, hub *Hub, framing string) *Connection {
+	conn := &Connection{
+		ws:         ws,
+		send:       make(chan outbound, hub.connSettings.sendBufferSize),
+		ephemeral:  newEphemeralQueue(hub.connSettings.ephemeralSize),
+		hub:        hub,
+		framing:    framing,
+		sessionID:  rand.Text(),
+		settings:   hub.connSettings,
+		registered: make(chan struct{}),
+		chats:      make(map[int]uint64),
+		limiter:    newRateLimiter(hub.connSettings.rateLimits),
+		violations: violationCounter{
+			max:    hub.connSettings.maxViolations,
+			window: hub.connSettings.violationWindow,
+		},
 	}
+	conn.touch()
+	return conn
 }
 
-// SetUser sets the authenticated user
-func (c *Connection) SetUser(user *models.User, token string) {
+// touch records inbound activity on the connection
+func (c *Connection) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// LastActivity returns the time of the last inbound frame
+func (c *Connection) LastActivity() time.Time {
+	return time.Unix(0, c.lastActivity.Load())
+}
+
+// SessionID returns the connection's session ID
+func (c *Connection) SessionID() string {
+	return c.sessionID
+}
+
+// SetUser sets the authenticated user and schedules token expiry handling.
+// Calling it again (reauth) replaces the token and reschedules.
+func (c *Connection) SetUser(user *models.User, token string, expiresAt time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.setUserLocked(user, token, expiresAt)
+}
+
+// bindUser is like SetUser, but only for an unauthenticated connection.
+// Returns false if a user is already set.
+func (c *Connection) bindUser(user *models.User, token string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.user != nil {
+		return false
+	}
+	c.setUserLocked(user, token, expiresAt)
+	return true
+}
+
+// setUserLocked implements SetUser. c.mu must be held.
+func (c *Connection) setUserLocked(user *models.User, token string, expiresAt time.Time) {
 	c.user = user
 	c.token = token
+	c.expiresAt = expiresAt
+
+	c.stopExpiryTimers()
+	if expiresAt.IsZero() || c.closed {
+		return
+	}
+
+	warnAt := time.Until(expiresAt) - c.settings.expiryWarning
+	if c.settings.expiryWarning > 0 && warnAt > 0 {
+		c.expiryTimers = append(c.expiryTimers, time.AfterFunc(warnAt, func() {
+			if c.GetToken() != token {
+				return
+			}
+			c.SendMessage(models.EventTokenExpiring, models.TokenExpiringData{
+				ExpiresAt: expiresAt.Unix(),
+				ExpiresIn: int(time.Until(expiresAt).Round(time.Second).Seconds()),
+			})
+		}))
+	}
+
+	c.expiryTimers = append(c.expiryTimers, time.AfterFunc(time.Until(expiresAt), func() {
+		if c.GetToken() != token {
+			return
+		}
+		log.Printf("Closing connection of user %d: token expired", user.ID)
+		c.CloseWithCode(models.CloseTokenExpired, "token expired")
+	}))
+}
+
+// stopExpiryTimers cancels pending expiry timers (c.mu must be held)
+func (c *Connection) stopExpiryTimers() {
+	for _, t := range c.expiryTimers {
+		t.Stop()
+	}
+	c.expiryTimers = nil
 }
 
 // GetUser returns the authenticated user
@@ -89,7 +263,13 @@ func (c *Connection) IsAuthenticated() bool {
 
 // SendMessage sends a message to the WebSocket client
 func (c *Connection) SendMessage(event string, data interface{}) error {
+	return c.SendReply("", event, data)
+}
+
+// SendReply sends a message echoing the client's request ID
+func (c *Connection) SendReply(requestID string, event string, data interface{}) error {
 	msg := models.WebSocketMessage{
+		ID:    requestID,
 		Event: event,
 	}
 
@@ -106,34 +286,90 @@ func (c *Connection) SendMessage(event string, data interface{}) error {
 		return err
 	}
 
+	c.enqueue(event, msgBytes)
+	return nil
+}
+
+// enqueue queues an encoded message for the write pump.
+// Ephemeral events replace the oldest queued ephemeral event when their
+// queue is full. Durable events are dropped or disconnect the client when
+// the send buffer is full, depending on the overflow policy.
+// Returns false if the connection is closed or the message was dropped.
+func (c *Connection) enqueue(event string, msgBytes []byte) bool {
+	msg := outbound{event: event, data: msgBytes}
+
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return false
+	}
+
+	if models.IsEphemeralEvent(event) {
+		dropped, ok := c.ephemeral.push(msg)
+		c.mu.RUnlock()
+		if ok {
+			c.hub.drops.add(dropped.event)
+		}
+		return true
+	}
+
 	select {
-	case c.send <- msgBytes:
-		return nil
+	case c.send <- msg:
+		c.mu.RUnlock()
+		return true
 	default:
-		return nil // Drop message if buffer is full
 	}
+	c.mu.RUnlock()
+
+	c.hub.drops.add(event)
+
+	// Buffer is full: drop the message, or disconnect the slow client
+	if c.settings.overflowPolicy == config.OverflowDisconnect {
+		log.Printf("Send buffer full, disconnecting slow client (%s)", event)
+		c.CloseWithCode(websocket.CloseTryAgainLater, "send buffer overflow")
+	}
+	return false
+}
+
+// SendAck confirms that the request was processed
+func (c *Connection) SendAck(requestID string, event string, result json.RawMessage) {
+	c.SendReply(requestID, models.EventAck, models.AckData{
+		Event:  event,
+		Result: result,
+	})
 }
 
-// SendError sends an error message to the client
-func (c *Connection) SendError(message string) {
-	c.SendMessage(models.EventError, models.ErrorData{
+// SendError sends an error message with an error code to the client
+func (c *Connection) SendError(requestID string, code string, message string) {
+	c.SendErrorData(requestID, models.ErrorData{
 		Message: message,
+		Code:    code,
 	})
 }
 
+// SendBackendError reports a failed api.Client call to the client
+func (c *Connection) SendBackendError(requestID string, message string, err error) {
+	c.SendErrorData(requestID, backendErrorData(message, err))
+}
+
+// SendErrorData sends a prepared error to the client
+func (c *Connection) SendErrorData(requestID string, data models.ErrorData) {
+	c.SendReply(requestID, models.EventError, data)
+}
+
 // readPump pumps messages from the WebSocket connection to the hub
 func (c *Connection) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.Unregister(c)
 		c.ws.Close()
 	}()
 
-	c.ws.SetReadDeadline(time.Now().Add(pongWait))
+	c.ws.SetReadDeadline(time.Now().Add(c.settings.pongWait))
 	c.ws.SetPongHandler(func(string) error {
-		c.ws.SetReadDeadline(time.Now().Add(pongWait))
+		c.ws.SetReadDeadline(time.Now().Add(c.settings.pongWait))
 		return nil
 	})
-	c.ws.SetReadLimit(maxMessageSize)
+	c.ws.SetReadLimit(c.settings.maxMessageSize)
 
 	for {
 		_, message, err := c.ws.ReadMessage()
@@ -144,56 +380,69 @@ func (c *Connection) readPump() {
 			break
 		}
 
+		c.touch()
+
 		// Parse message
 		var msg models.WebSocketMessage
 		if err := json.Unmarshal(message, &msg); err != nil {
 			log.Printf("Invalid message format: %v", err)
-			c.SendError("Invalid message format")
+			c.SendError("", models.ErrCodeInvalidPayload, "Invalid message format")
+			continue
+		}
+
+		// Stop dispatching once the hub is shutting down
+		if !c.hub.beginHandler() {
+			c.SendError(msg.ID, models.ErrCodeShuttingDown, "Server is shutting down")
 			continue
 		}
 
 		// Handle message
 		c.hub.handleMessage(c, &msg)
+		c.hub.endHandler()
 	}
 }
 
 // writePump pumps messages from the hub to the WebSocket connection
 func (c *Connection) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.settings.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.ws.Close()
+		c.hub.connDone()
 	}()
 
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel
-				c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+				c.ws.SetWriteDeadline(time.Now().Add(c.settings.writeWait))
+				c.ws.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
 
-			w, err := c.ws.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued messages to the current WebSocket message
+			// Send queued messages along with this one
+			messages := []outbound{message}
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+				queued, ok := <-c.send
+				if !ok {
+					break
+				}
+				messages = append(messages, queued)
 			}
 
-			if err := w.Close(); err != nil {
+			if err := c.writeFrames(messages); err != nil {
+				return
+			}
+
+		case <-c.ephemeral.ready:
+			if err := c.writeFrames(c.ephemeral.drain()); err != nil {
 				return
 			}
 
 		case <-ticker.C:
-			c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+			c.ws.SetWriteDeadline(time.Now().Add(c.settings.writeWait))
 			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -201,19 +450,70 @@ func (c *Connection) writePump() {
 	}
 }
 
+// writeFrames writes messages using the connection's framing
+func (c *Connection) writeFrames(messages []outbound) error {
+	for _, frame := range encodeFrames(c.framing, messages) {
+		c.ws.SetWriteDeadline(time.Now().Add(c.settings.writeWait))
+		if err := c.ws.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return err
+		}
+		c.hub.metrics.outboundFrames.Inc()
+	}
+	return nil
+}
+
 // Start starts the connection's read and write pumps
 func (c *Connection) Start() {
+	if !c.hub.addClient(c) {
+		// Hub is shutting down, refuse the connection
+		c.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restart"),
+			time.Now().Add(c.settings.writeWait))
+		c.ws.Close()
+		return
+	}
+
 	go c.writePump()
 	go c.readPump()
+
+	// Close connections that never authenticate
+	if c.settings.authTimeout > 0 {
+		time.AfterFunc(c.settings.authTimeout, func() {
+			if !c.IsAuthenticated() {
+				log.Printf("Closing connection: authentication timeout")
+				c.CloseWithCode(models.CloseAuthTimeout, "authentication timeout")
+			}
+		})
+	}
 }
 
 // Close closes the connection
 func (c *Connection) Close() {
+	c.CloseWithCode(0, "")
+}
+
+// CloseWithCode closes the connection after queued messages are written,
+// sending a close frame with the given code and reason
+func (c *Connection) CloseWithCode(code int, reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if !c.closed {
 		c.closed = true
+		c.closeCode = code
+		c.closeReason = reason
+		c.stopExpiryTimers()
 		close(c.send)
 	}
 }
+
+// closeMessage returns the payload of the close frame
+func (c *Connection) closeMessage() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closeCode == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+}
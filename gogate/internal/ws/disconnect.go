@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// DisconnectHandler lets the backend force-close a user's connections,
+// e.g. after logout or deactivation
+type DisconnectHandler struct {
+	hub    *Hub
+	apiKey string
+}
+
+// NewDisconnectHandler creates a new disconnect handler guarded by the internal API key
+func NewDisconnectHandler(hub *Hub, apiKey string) *DisconnectHandler {
+	return &DisconnectHandler{
+		hub:    hub,
+		apiKey: apiKey,
+	}
+}
+
+// tokenHash identifies an access token without passing it around
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP handles disconnect requests from the backend
+func (h *DisconnectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !checkInternalAPIKey(r, h.apiKey) {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+
+	var req models.DisconnectRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBodySize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if req.UserID <= 0 {
+		writeJSONError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	// Connections may live on other gateway instances, so the result is not known here
+	h.hub.DisconnectUser(req.UserID, req.SessionID, req.Token, req.Reason)
+
+	log.Printf("Requested disconnect of user %d (session %q, by token %t, reason %q)",
+		req.UserID, req.SessionID, req.Token != "", req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"accepted"}`))
+}
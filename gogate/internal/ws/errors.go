@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/models"
+)
+
+// backendErrorData maps an api.Client error to a client-safe error.
+// Backend 4xx messages are meant for clients and are passed through;
+// server and transport failures are reported generically.
+func backendErrorData(message string, err error) models.ErrorData {
+	var apiErr *api.Error
+	if !errors.As(err, &apiErr) {
+		if errors.Is(err, api.ErrUnavailable) {
+			return models.ErrorData{
+				Message: message + ": backend unavailable",
+				Code:    models.ErrCodeBackendUnavailable,
+			}
+		}
+		return models.ErrorData{
+			Message: message,
+			Code:    models.ErrCodeInternal,
+		}
+	}
+
+	data := models.ErrorData{
+		Message: message,
+		Code:    backendErrorCode(apiErr.StatusCode),
+		Status:  apiErr.StatusCode,
+	}
+	if apiErr.StatusCode < http.StatusInternalServerError && apiErr.Message != "" {
+		data.Message = message + ": " + apiErr.Message
+	}
+	return data
+}
+
+// chatErrorData is like backendErrorData for operations the backend only
+// denies to non-members of the chat (send_message, add_reaction, mark_read),
+// so every such event reports NOT_A_MEMBER for a 403. Edits and deletes are
+// denied to non-authors and keep FORBIDDEN.
+func chatErrorData(message string, err error) models.ErrorData {
+	data := backendErrorData(message, err)
+	if data.Status == http.StatusForbidden {
+		data.Code = models.ErrCodeNotAMember
+	}
+	return data
+}
+
+// backendErrorCode maps a backend HTTP status to an error code
+func backendErrorCode(status int) string {
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return models.ErrCodeInvalidPayload
+	case status == http.StatusUnauthorized:
+		return models.ErrCodeAuthFailed
+	case status == http.StatusForbidden:
+		return models.ErrCodeForbidden
+	case status == http.StatusNotFound:
+		return models.ErrCodeNotFound
+	case status == http.StatusTooManyRequests:
+		return models.ErrCodeRateLimited
+	case status == http.StatusServiceUnavailable, status == http.StatusBadGateway, status == http.StatusGatewayTimeout:
+		return models.ErrCodeBackendUnavailable
+	default:
+		return models.ErrCodeBackendError
+	}
+}
@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/models"
+)
+
+func TestBackendErrorCodes(t *testing.T) {
+	forbidden := &api.Error{StatusCode: http.StatusForbidden, Message: "You are not a member of this chat"}
+
+	tests := []struct {
+		name string
+		data models.ErrorData
+		want string
+	}{
+		{"chat operation 403", chatErrorData("Failed to add reaction", forbidden), models.ErrCodeNotAMember},
+		{"other operation 403", backendErrorData("Failed to edit message", forbidden), models.ErrCodeForbidden},
+		{"chat operation 404", chatErrorData("Failed to add reaction", &api.Error{StatusCode: http.StatusNotFound}), models.ErrCodeNotFound},
+		{"unavailable", chatErrorData("Failed to send message", fmt.Errorf("do request: %w", api.ErrUnavailable)), models.ErrCodeBackendUnavailable},
+	}
+
+	for _, tt := range tests {
+		if tt.data.Code != tt.want {
+			t.Errorf("%s: code = %s, want %s", tt.name, tt.data.Code, tt.want)
+		}
+	}
+
+	// Backend 4xx messages reach the client
+	if got := chatErrorData("Failed to send message", forbidden).Message; got != "Failed to send message: You are not a member of this chat" {
+		t.Errorf("message = %q", got)
+	}
+}
@@ -0,0 +1,266 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"maps"
+	"strconv"
+	"sync"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// loggedEvent is an encoded server event kept for replay
+type loggedEvent struct {
+	seq   uint64
+	event string
+	data  []byte
+	at    time.Time
+
+	// Chat whose subscribers received the event, 0 if all of the user's
+	// connections did
+	chatID int
+}
+
+// eventLog keeps the latest durable events sent to a user, numbered with
+// increasing sequence numbers, so reconnecting clients can resume.
+// The epoch changes whenever a log is recreated (e.g. gateway restart),
+// which makes sequence numbers from an older log unusable.
+type eventLog struct {
+	epoch string
+	size  int
+	ttl   time.Duration
+
+	mu     sync.Mutex
+	seq    uint64
+	events []loggedEvent // oldest first
+
+	// Time the user's last connection closed (zero while online); guarded by Hub.mu
+	offlineSince time.Time
+
+	// Chats whose events are logged: subscriptions of the user's
+	// connections, kept after they close; guarded by Hub.mu
+	chats map[int]bool
+}
+
+// newEventLog creates an empty event log with a new epoch
+func newEventLog(size int, ttl time.Duration) *eventLog {
+	return &eventLog{
+		epoch: rand.Text(),
+		size:  size,
+		ttl:   ttl,
+		chats: make(map[int]bool),
+	}
+}
+
+// encodedEvent is a server event encoded once for all its recipients
+type encodedEvent struct {
+	event string
+	msg   []byte // encoded message without a sequence number
+}
+
+// encodeEvent encodes an event message without a sequence number
+func encodeEvent(event string, data json.RawMessage) (encodedEvent, error) {
+	msg, err := json.Marshal(models.WebSocketMessage{Event: event, Data: data})
+	if err != nil {
+		return encodedEvent{}, err
+	}
+	return encodedEvent{event: event, msg: msg}, nil
+}
+
+// withSeq returns the encoded message numbered with seq. The result matches
+// encoding a WebSocketMessage with Seq set, which puts seq before event.
+func (e encodedEvent) withSeq(seq uint64) []byte {
+	msgBytes := make([]byte, 0, len(e.msg)+24)
+	msgBytes = append(msgBytes, `{"seq":`...)
+	msgBytes = strconv.AppendUint(msgBytes, seq, 10)
+	msgBytes = append(msgBytes, ',')
+	return append(msgBytes, e.msg[1:]...)
+}
+
+// append numbers and stores an event, then passes the numbered message to
+// deliver while still holding the lock, so connections receive events in
+// sequence order
+func (l *eventLog) append(chatID int, ev encodedEvent, deliver func(msgBytes []byte)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	msgBytes := ev.withSeq(l.seq)
+
+	now := time.Now()
+	l.trim(now)
+	if len(l.events) >= l.size {
+		l.events = l.events[1:]
+	}
+	l.events = append(l.events, loggedEvent{seq: l.seq, event: ev.event, data: msgBytes, at: now, chatID: chatID})
+
+	deliver(msgBytes)
+}
+
+// lastSeq returns the sequence number of the latest event
+func (l *eventLog) lastSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq
+}
+
+// between returns the events with afterSeq < seq <= untilSeq.
+// Returns false if some of them are no longer retained or afterSeq is unknown.
+func (l *eventLog) between(afterSeq, untilSeq uint64) ([]loggedEvent, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if afterSeq > l.seq {
+		return nil, false
+	}
+	if afterSeq >= untilSeq {
+		return nil, true
+	}
+
+	l.trim(time.Now())
+
+	// The event right after afterSeq must still be retained
+	if len(l.events) == 0 || l.events[0].seq > afterSeq+1 {
+		return nil, false
+	}
+
+	var events []loggedEvent
+	for _, event := range l.events {
+		if event.seq > afterSeq && event.seq <= untilSeq {
+			events = append(events, event)
+		}
+	}
+	return events, true
+}
+
+// trim drops events older than the retention period (l.mu must be held)
+func (l *eventLog) trim(now time.Time) {
+	n := 0
+	for n < len(l.events) && now.Sub(l.events[n].at) > l.ttl {
+		n++
+	}
+	l.events = l.events[n:]
+}
+
+// userLog returns the user's event log, creating it if needed
+func (h *Hub) userLog(userID int) *eventLog {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	eventLog, ok := h.eventLogs[userID]
+	if !ok {
+		eventLog = newEventLog(h.eventLogSize, h.eventLogTTL)
+		h.eventLogs[userID] = eventLog
+	}
+	return eventLog
+}
+
+// deliver logs a durable event for a user and sends it to all their
+// connections. Users without a log (not seen recently) are skipped.
+// h.mu must be held.
+func (h *Hub) deliver(userID int, ev encodedEvent) {
+	h.deliverTo(userID, 0, h.connections[userID], ev)
+}
+
+// deliverTo is like deliver, but sends the event only to the given
+// connections of the user: the subscribers of chatID, if set. h.mu must be held.
+func (h *Hub) deliverTo(userID, chatID int, conns map[*Connection]bool, ev encodedEvent) {
+	eventLog, ok := h.eventLogs[userID]
+	if !ok {
+		return
+	}
+
+	eventLog.append(chatID, ev, func(msgBytes []byte) {
+		for conn := range conns {
+			conn.enqueue(ev.event, msgBytes)
+		}
+	})
+}
+
+// purgeEventLogs drops logs of users offline for longer than the retention period
+func (h *Hub) purgeEventLogs() {
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userID, eventLog := range h.eventLogs {
+		if eventLog.offlineSince.IsZero() {
+			continue
+		}
+		if now.Sub(eventLog.offlineSince) > h.eventLogTTL {
+			for chatID := range eventLog.chats {
+				h.unlogChat(userID, chatID)
+			}
+			delete(h.eventLogs, userID)
+		}
+	}
+}
+
+// handleResume replays events the client missed while disconnected
+func (h *Hub) handleResume(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.ResumeData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid resume data")
+		return
+	}
+
+	// Events after liveFrom are delivered live once the connection is registered
+	select {
+	case <-conn.registered:
+	case <-h.quit:
+		return
+	}
+
+	// Chat events are delivered live only once the chat is subscribed,
+	// earlier ones are replayed up to that point
+	user := conn.GetUser()
+	h.mu.RLock()
+	eventLog := h.eventLogs[user.ID]
+	subscribedAt := maps.Clone(conn.chats)
+	h.mu.RUnlock()
+
+	untilSeq := conn.liveFrom
+	for _, seq := range subscribedAt {
+		untilSeq = max(untilSeq, seq)
+	}
+
+	if eventLog == nil || data.Epoch != eventLog.epoch {
+		conn.SendReply(msg.ID, models.EventResyncRequired, models.ResyncRequiredData{
+			Reason: "Event log is no longer available",
+		})
+		return
+	}
+
+	logged, ok := eventLog.between(data.LastSeq, untilSeq)
+	if !ok {
+		conn.SendReply(msg.ID, models.EventResyncRequired, models.ResyncRequiredData{
+			Reason: "Missed events are no longer available",
+		})
+		return
+	}
+
+	var events []loggedEvent
+	for _, event := range logged {
+		if event.seq <= conn.liveFrom || event.seq <= subscribedAt[event.chatID] {
+			events = append(events, event)
+		}
+	}
+
+	// Replaying more than fits the send buffer would disconnect the client
+	if len(events) > cap(conn.send)-len(conn.send) {
+		conn.SendReply(msg.ID, models.EventResyncRequired, models.ResyncRequiredData{
+			Reason: "Too many missed events",
+		})
+		return
+	}
+
+	for _, event := range events {
+		conn.enqueue(event.event, event.data)
+	}
+
+	result, _ := json.Marshal(models.ResumeResult{Replayed: len(events)})
+	conn.SendAck(msg.ID, models.EventResume, result)
+}
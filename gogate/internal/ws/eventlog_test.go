@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+func TestEncodedEventWithSeq(t *testing.T) {
+	tests := []struct {
+		event string
+		data  json.RawMessage
+		seq   uint64
+	}{
+		{"new_message", json.RawMessage(`{"id":1,"content":"hi"}`), 1},
+		{"message_deleted", json.RawMessage(`{"id":2}`), 18446744073709551615},
+		{"chat_deleted", nil, 42},
+	}
+
+	for _, tt := range tests {
+		ev, err := encodeEvent(tt.event, tt.data)
+		if err != nil {
+			t.Fatalf("encodeEvent(%q): %v", tt.event, err)
+		}
+		want, _ := json.Marshal(models.WebSocketMessage{Seq: tt.seq, Event: tt.event, Data: tt.data})
+		if got := ev.withSeq(tt.seq); string(got) != string(want) {
+			t.Errorf("withSeq(%d) = %s, want %s", tt.seq, got, want)
+		}
+	}
+}
+
+func TestEventLogAppendNumbersEvents(t *testing.T) {
+	l := newEventLog(2, time.Minute)
+	ev, _ := encodeEvent("new_message", json.RawMessage(`{"id":1}`))
+
+	var delivered []string
+	for range 3 {
+		l.append(0, ev, func(msgBytes []byte) { delivered = append(delivered, string(msgBytes)) })
+	}
+
+	if want := `{"seq":3,"event":"new_message","data":{"id":1}}`; delivered[2] != want {
+		t.Errorf("third message = %s, want %s", delivered[2], want)
+	}
+	events, ok := l.between(1, 3)
+	if !ok || len(events) != 2 || events[0].seq != 2 || string(events[1].data) != delivered[2] {
+		t.Errorf("between(1, 3) = %v, %v", events, ok)
+	}
+}
@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Frame encodings, chosen by the client at connect time (?framing=)
+const (
+	// framingSingle sends every event in its own text frame (default)
+	framingSingle = "single"
+
+	// framingBatch sends queued events together as a JSON array per frame
+	framingBatch = "batch"
+)
+
+// parseFraming validates the framing requested by the client
+func parseFraming(value string) (string, error) {
+	switch value {
+	case "", framingSingle:
+		return framingSingle, nil
+	case framingBatch:
+		return framingBatch, nil
+	}
+	return "", fmt.Errorf("unsupported framing %q", value)
+}
+
+// encodeFrames turns queued messages into text frame payloads.
+// Each message must be an encoded JSON object. In single mode every message
+// is its own frame; in batch mode all messages form one JSON array frame.
+func encodeFrames(framing string, messages []outbound) [][]byte {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if framing != framingBatch {
+		frames := make([][]byte, len(messages))
+		for i, msg := range messages {
+			frames[i] = msg.data
+		}
+		return frames
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, msg := range messages {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(msg.data)
+	}
+	buf.WriteByte(']')
+	return [][]byte{buf.Bytes()}
+}
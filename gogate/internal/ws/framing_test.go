@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/broker"
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+var framingMessages = []outbound{
+	{event: "a", data: []byte(`{"event":"a","data":{"n":1}}`)},
+	{event: "b", data: []byte(`{"event":"b","data":{"n":2}}`)},
+	{event: "c", data: []byte(`{"event":"c","data":{"n":3}}`)},
+}
+
+func TestParseFraming(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", framingSingle, false},
+		{"single", framingSingle, false},
+		{"batch", framingBatch, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFraming(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseFraming(%q) = %q, %v; want %q, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEncodeFramesSingle(t *testing.T) {
+	frames := encodeFrames(framingSingle, framingMessages)
+	if len(frames) != len(framingMessages) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(framingMessages))
+	}
+
+	for i, frame := range frames {
+		if string(frame) != string(framingMessages[i].data) {
+			t.Errorf("frame %d = %s, want %s", i, frame, framingMessages[i].data)
+		}
+	}
+}
+
+func TestEncodeFramesBatch(t *testing.T) {
+	frames := encodeFrames(framingBatch, framingMessages)
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(frames))
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(frames[0], &batch); err != nil {
+		t.Fatalf("batch frame is not a JSON array: %v", err)
+	}
+	if len(batch) != len(framingMessages) {
+		t.Fatalf("got %d messages in batch, want %d", len(batch), len(framingMessages))
+	}
+	for i, msg := range batch {
+		if string(msg) != string(framingMessages[i].data) {
+			t.Errorf("message %d = %s, want %s", i, msg, framingMessages[i].data)
+		}
+	}
+}
+
+func TestEncodeFramesEmpty(t *testing.T) {
+	for _, framing := range []string{framingSingle, framingBatch} {
+		if frames := encodeFrames(framing, nil); frames != nil {
+			t.Errorf("%s: got %d frames for no messages", framing, len(frames))
+		}
+	}
+}
+
+// newFramingHub creates a hub that is never run, enough for write pumps
+func newFramingHub(t *testing.T) *Hub {
+	t.Helper()
+
+	reg := metrics.NewRegistry()
+	cfg := &config.Config{
+		SendBufferSize:      16,
+		EphemeralBufferSize: 16,
+		MemberCacheTTL:      30,
+		PingPeriod:          54,
+		PongWait:            60,
+		WriteWait:           10,
+		MaxMessageSize:      512000,
+	}
+
+	hub, err := NewHub(api.NewClient("http://127.0.0.1:0", "", reg), broker.NewMemoryBroker(), reg, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hub
+}
+
+// readFrames writes the queued messages through writePump and returns the
+// text frames a client receives until the connection closes
+func readFrames(t *testing.T, framing string) [][]byte {
+	t.Helper()
+
+	hub := newFramingHub(t)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+
+		conn := NewConnection(ws, hub, framing)
+		hub.addClient(conn)
+
+		// Queue everything before the pump starts so it is sent in one batch
+		for _, msg := range framingMessages {
+			conn.send <- msg
+		}
+		close(conn.send)
+
+		go conn.writePump()
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var frames [][]byte
+	for {
+		messageType, frame, err := client.ReadMessage()
+		if err != nil {
+			break
+		}
+		if messageType != websocket.TextMessage {
+			t.Errorf("got message type %d, want text", messageType)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func TestWritePumpSingle(t *testing.T) {
+	frames := readFrames(t, framingSingle)
+	if len(frames) != len(framingMessages) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(framingMessages))
+	}
+
+	for i, frame := range frames {
+		var msg struct {
+			Event string `json:"event"`
+		}
+		if err := json.Unmarshal(frame, &msg); err != nil {
+			t.Fatalf("frame %d is not a JSON object: %v", i, err)
+		}
+		if msg.Event != framingMessages[i].event {
+			t.Errorf("frame %d has event %q, want %q", i, msg.Event, framingMessages[i].event)
+		}
+	}
+}
+
+func TestWritePumpBatch(t *testing.T) {
+	frames := readFrames(t, framingBatch)
+	if len(frames) != 1 {
+		t.Fatalf("got %d frames, want 1", len(frames))
+	}
+
+	var batch []struct {
+		Event string `json:"event"`
+	}
+	if err := json.Unmarshal(frames[0], &batch); err != nil {
+		t.Fatalf("frame is not a JSON array: %v", err)
+	}
+	if len(batch) != len(framingMessages) {
+		t.Fatalf("got %d messages in batch, want %d", len(batch), len(framingMessages))
+	}
+	for i, msg := range batch {
+		if msg.Event != framingMessages[i].event {
+			t.Errorf("message %d has event %q, want %q", i, msg.Event, framingMessages[i].event)
+		}
+	}
+}
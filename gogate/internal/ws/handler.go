@@ -1,47 +1,139 @@
 package ws
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/models"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: Add origin validation for production
-		return true
-	},
-}
+// Subprotocol negotiated with clients that pass the token in Sec-WebSocket-Protocol
+const subprotocol = "buzzchat.v1"
+
+// Prefix of the subprotocol entry carrying the access token ("bearer.<jwt>")
+const bearerProtocolPrefix = "bearer."
 
 // Handler handles WebSocket upgrade requests
 type Handler struct {
-	hub *Hub
+	hub      *Hub
+	origins  *originPolicy
+	upgrader websocket.Upgrader
 }
 
 // NewHandler creates a new WebSocket handler
-func NewHandler(hub *Hub) *Handler {
-	return &Handler{
-		hub: hub,
+func NewHandler(hub *Hub, cfg *config.Config) (*Handler, error) {
+	origins, err := newOriginPolicy(cfg.AllowedOrigins, cfg.DevMode)
+	if err != nil {
+		return nil, err
 	}
+
+	return &Handler{
+		hub:     hub,
+		origins: origins,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  cfg.ReadBufferSize,
+			WriteBufferSize: cfg.WriteBufferSize,
+			Subprotocols:    []string{subprotocol},
+			CheckOrigin: func(r *http.Request) bool {
+				// Checked in ServeHTTP before the token is validated
+				return true
+			},
+		},
+	}, nil
 }
 
 // ServeHTTP handles HTTP requests for WebSocket upgrade
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Refuse new connections while draining
+	if h.hub.IsShuttingDown() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Reject cross-site upgrades before touching credentials
+	if ok, reason := h.origins.check(r); !ok {
+		log.Printf("Rejected WebSocket upgrade from %s: %s", r.RemoteAddr, reason)
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	framing, err := parseFraming(r.URL.Query().Get("framing"))
+	if err != nil {
+		http.Error(w, "Unsupported framing", http.StatusBadRequest)
+		return
+	}
+
+	// Long-lived JWTs must not appear in URLs, tickets are the only URL credential
+	if r.URL.Query().Has("token") {
+		log.Printf("Rejected upgrade from %s with token in URL", r.RemoteAddr)
+		http.Error(w, "Tokens in the URL are not accepted, use a ticket from /ws/ticket", http.StatusBadRequest)
+		return
+	}
+
+	// Authenticate before upgrading when the client passed a ticket or bearer subprotocol
+	var user *models.User
+	var token string
+	var expiresAt time.Time
+	if id := r.URL.Query().Get("ticket"); id != "" {
+		user, token, expiresAt, err = h.hub.tickets.Redeem(id)
+		if err != nil {
+			if errors.Is(err, ErrInvalidTicket) {
+				log.Printf("Upgrade from %s with invalid or used ticket", r.RemoteAddr)
+				http.Error(w, "Invalid ticket", http.StatusUnauthorized)
+			} else {
+				log.Printf("Error redeeming ticket from %s: %v", r.RemoteAddr, err)
+				http.Error(w, "Authentication unavailable", http.StatusServiceUnavailable)
+			}
+			return
+		}
+	} else if token = upgradeToken(r); token != "" {
+		user, expiresAt, err = h.hub.apiClient.ValidateToken(token)
+		if err != nil {
+			log.Printf("Upgrade auth failed from %s: %v", r.RemoteAddr, err)
+			if errors.Is(err, api.ErrUnavailable) {
+				http.Error(w, "Authentication unavailable", http.StatusServiceUnavailable)
+			} else {
+				http.Error(w, "Authentication failed", http.StatusUnauthorized)
+			}
+			return
+		}
+	}
+
 	// Upgrade HTTP connection to WebSocket
-	ws, err := upgrader.Upgrade(w, r, nil)
+	ws, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
 	// Create new connection
-	conn := NewConnection(ws, h.hub)
+	conn := NewConnection(ws, h.hub, framing)
 
 	// Start connection pumps
 	conn.Start()
 
 	log.Printf("New WebSocket connection from %s", r.RemoteAddr)
+
+	if user != nil {
+		h.hub.authenticate(conn, "", user, token, expiresAt)
+	}
+}
+
+// upgradeToken extracts the access token passed with the upgrade request as
+// a "bearer.<jwt>" subprotocol. Tokens in the URL are not accepted, they end
+// up in access logs.
+func upgradeToken(r *http.Request) string {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, bearerProtocolPrefix) {
+			return strings.TrimPrefix(protocol, bearerProtocolPrefix)
+		}
+	}
+	return ""
 }
@@ -1,14 +1,23 @@
 package ws
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/broker"
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/metrics"
 	"buzzchat-gogate/internal/models"
 )
 
+// memberCachePurgePeriod is how often expired member cache entries are dropped
+const memberCachePurgePeriod = time.Minute
+
 // Hub maintains the set of active connections and broadcasts messages
 type Hub struct {
 	// Registered connections (userID -> set of connections)
@@ -23,22 +32,167 @@ type Hub struct {
 	// Backend API client
 	apiClient *api.Client
 
+	// Distributes events between gateway instances
+	broker broker.Broker
+
+	// Cached chat members, used on membership changes and presence updates
+	members *memberCache
+
+	// Cached chats of each user, used to find presence peers
+	chatLists *chatListCache
+
+	// Chat subscriptions (chatID -> subscribed connections); guarded by mu
+	subscriptions map[int]map[*Connection]bool
+
+	// Users whose event log records a chat (chatID -> userIDs), including
+	// offline users; guarded by mu
+	chatLogs map[int]map[int]bool
+
+	// Subscribe new connections to all chats of their user
+	autoSubscribe bool
+
+	// Pending single-use connection tickets
+	tickets *TicketStore
+
+	// Inbound event rate limits shared by a user's connections
+	userLimiters *userRateLimiters
+
+	// Active typing indicators
+	typing *typingTracker
+
+	// Outbound messages dropped for slow clients, per event type
+	drops *dropCounter
+
+	// Durable events per user, kept for resume (userID -> log); guarded by mu
+	eventLogs    map[int]*eventLog
+	eventLogSize int
+	eventLogTTL  time.Duration
+
+	// Status of connected users (userID -> state)
+	presence map[int]presenceState
+
+	// Pending presence updates, processed in order
+	presenceUpdates chan presenceUpdate
+
+	// Identifies this instance in presence announcements
+	instanceID string
+
+	// Users connected to other instances (userID -> instance -> last
+	// announcement); guarded by mu
+	remotePresence map[int]map[string]time.Time
+
+	// Tokens of users who went offline here, used to report offline once
+	// the user is offline on all instances; guarded by mu
+	offlineTokens map[int]string
+
+	// Report presence changes to backend
+	reportPresence bool
+
+	// Idle period after which available users become away (0 disables)
+	autoAwayAfter time.Duration
+
+	// All started connections, including unauthenticated ones
+	clients map[*Connection]bool
+
+	// Running write pumps, awaited on shutdown
+	clientsWG sync.WaitGroup
+
+	// Closed to stop the Run loop
+	quit chan struct{}
+
+	// Set once shutdown begins; guarded by shutdownMu
+	stopping   bool
+	shutdownMu sync.RWMutex
+
+	// In-flight event handlers, awaited on shutdown
+	handlers sync.WaitGroup
+
+	// Reconnect hint sent to clients on shutdown
+	reconnectDelay time.Duration
+
+	// Settings applied to every new connection
+	connSettings connSettings
+
+	// Metrics updated by the hub and its connections
+	metrics *hubMetrics
+
 	// Mutex for thread-safe operations
 	mu sync.RWMutex
 }
 
-// NewHub creates a new Hub
-func NewHub(apiClient *api.Client) *Hub {
-	return &Hub{
+// NewHub creates a new Hub and subscribes it to the broker
+func NewHub(apiClient *api.Client, bus broker.Broker, reg *metrics.Registry, cfg *config.Config) (*Hub, error) {
+	h := &Hub{
 		connections: make(map[int]map[*Connection]bool),
 		register:    make(chan *Connection),
 		unregister:  make(chan *Connection),
 		apiClient:   apiClient,
+		broker:      bus,
+		members:     newMemberCache(time.Duration(cfg.MemberCacheTTL)*time.Second, apiClient.GetChatMembers),
+		chatLists:   newChatListCache(time.Duration(cfg.MemberCacheTTL)*time.Second, apiClient.GetUserChats),
+		tickets:     NewTicketStore(time.Duration(cfg.TicketTTL)*time.Second, sharedStore(bus)),
+
+		subscriptions: make(map[int]map[*Connection]bool),
+		chatLogs:      make(map[int]map[int]bool),
+		autoSubscribe: cfg.AutoSubscribe,
+
+		userLimiters: newUserRateLimiters(cfg.UserRateLimits),
+		drops:        newDropCounter(),
+		eventLogs:    make(map[int]*eventLog),
+		eventLogSize: cfg.EventLogSize,
+		eventLogTTL:  time.Duration(cfg.EventLogTTL) * time.Second,
+		typing: newTypingTracker(
+			time.Duration(cfg.TypingThrottle)*time.Second,
+			time.Duration(cfg.TypingTimeout)*time.Second,
+		),
+
+		presence:        make(map[int]presenceState),
+		presenceUpdates: make(chan presenceUpdate, presenceQueueSize),
+		instanceID:      rand.Text(),
+		remotePresence:  make(map[int]map[string]time.Time),
+		offlineTokens:   make(map[int]string),
+		reportPresence:  cfg.PresenceReport,
+		autoAwayAfter:   time.Duration(cfg.AutoAwayAfter) * time.Second,
+
+		clients:        make(map[*Connection]bool),
+		quit:           make(chan struct{}),
+		reconnectDelay: time.Duration(cfg.ReconnectDelay) * time.Second,
+		connSettings:   newConnSettings(cfg),
 	}
+
+	h.metrics = newHubMetrics(reg, h)
+
+	if err := bus.Subscribe(h.handleEnvelope); err != nil {
+		return nil, fmt.Errorf("failed to subscribe to broker: %w", err)
+	}
+
+	return h, nil
+}
+
+// sharedStore returns the broker's shared store, or nil if the broker only
+// reaches this instance
+func sharedStore(bus broker.Broker) broker.Store {
+	if store, ok := bus.(broker.Store); ok {
+		return store
+	}
+	return nil
 }
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
+	purgeTicker := time.NewTicker(memberCachePurgePeriod)
+	defer purgeTicker.Stop()
+
+	// Idle checks run only when auto-away is enabled
+	var idleTicks <-chan time.Time
+	if h.autoAwayAfter > 0 {
+		idleTicker := time.NewTicker(idleCheckPeriod(h.autoAwayAfter))
+		defer idleTicker.Stop()
+		idleTicks = idleTicker.C
+	}
+
+	go h.presenceLoop()
+
 	for {
 		select {
 		case conn := <-h.register:
@@ -46,10 +200,87 @@ func (h *Hub) Run() {
 
 		case conn := <-h.unregister:
 			h.unregisterConnection(conn)
+
+		case <-purgeTicker.C:
+			h.members.PurgeExpired()
+			h.chatLists.PurgeExpired()
+			h.tickets.PurgeExpired()
+			h.userLimiters.PurgeIdle()
+			h.purgeEventLogs()
+
+		case <-idleTicks:
+			h.checkIdle()
+
+		case <-h.quit:
+			return
 		}
 	}
 }
 
+// Register queues an authenticated connection for registration
+func (h *Hub) Register(conn *Connection) {
+	select {
+	case h.register <- conn:
+	case <-h.quit:
+		// Hub loop stopped, nothing to register with
+	}
+}
+
+// Unregister queues a connection for removal
+func (h *Hub) Unregister(conn *Connection) {
+	select {
+	case h.unregister <- conn:
+	case <-h.quit:
+		h.unregisterConnection(conn)
+	}
+}
+
+// addClient tracks a started connection.
+// Returns false once shutdown has begun.
+func (h *Hub) addClient(conn *Connection) bool {
+	h.shutdownMu.RLock()
+	defer h.shutdownMu.RUnlock()
+
+	if h.stopping {
+		return false
+	}
+
+	h.clientsWG.Add(1)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[conn] = true
+
+	return true
+}
+
+// connDone marks a connection's write pump as finished
+func (h *Hub) connDone() {
+	h.clientsWG.Done()
+}
+
+// idleCheckPeriod returns how often idle users are checked for auto-away
+func idleCheckPeriod(autoAwayAfter time.Duration) time.Duration {
+	period := autoAwayAfter / 4
+	if period > 30*time.Second {
+		period = 30 * time.Second
+	}
+	if period < time.Second {
+		period = time.Second
+	}
+	return period
+}
+
+// DropStats returns the number of outbound messages dropped per event type
+func (h *Hub) DropStats() map[string]uint64 {
+	return h.drops.Snapshot()
+}
+
+// MemberCacheStats returns chat member cache hit and miss counters
+func (h *Hub) MemberCacheStats() (hits, misses uint64) {
+	return h.members.Stats()
+}
+
 // registerConnection registers a connection for a user
 func (h *Hub) registerConnection(conn *Connection) {
 	if !conn.IsAuthenticated() {
@@ -60,32 +291,99 @@ func (h *Hub) registerConnection(conn *Connection) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	// Upgrade-time auth registers after the pumps started: the connection
+	// may have been refused on shutdown or unregistered while the backend
+	// was queried, and must not be added back
+	if !h.clients[conn] {
+		if eventLog, ok := h.eventLogs[user.ID]; ok && len(h.connections[user.ID]) == 0 && eventLog.offlineSince.IsZero() {
+			// Let the log created for this connection expire
+			eventLog.offlineSince = time.Now()
+		}
+		// Release handlers waiting for the registration
+		select {
+		case <-conn.registered:
+		default:
+			close(conn.registered)
+		}
+		return
+	}
+
 	if h.connections[user.ID] == nil {
 		h.connections[user.ID] = make(map[*Connection]bool)
 	}
 	h.connections[user.ID][conn] = true
 
+	// Events from here on are delivered live
+	eventLog, ok := h.eventLogs[user.ID]
+	if !ok {
+		eventLog = newEventLog(h.eventLogSize, h.eventLogTTL)
+		h.eventLogs[user.ID] = eventLog
+	}
+	eventLog.offlineSince = time.Time{}
+	select {
+	case <-conn.registered:
+	default:
+		// Subscribing in the same step leaves no events between going live
+		// and subscribing, which neither delivery nor resume would cover
+		h.subscribe(conn, conn.initialChats)
+		conn.initialChats = nil
+		conn.liveFrom = eventLog.lastSeq()
+		close(conn.registered)
+	}
+
+	// First connection brings the user online
+	if len(h.connections[user.ID]) == 1 {
+		delete(h.offlineTokens, user.ID)
+		h.queuePresence(presenceUpdate{userID: user.ID, status: models.StatusAvailable, announce: true})
+
+		state := presenceState{status: models.StatusAvailable}
+		if h.onlineElsewhere(user.ID, time.Now()) {
+			// Peers already see the user online through another instance
+			h.presence[user.ID] = state
+		} else {
+			h.setPresence(user.ID, conn.GetToken(), state)
+		}
+	}
+
 	log.Printf("User %d (%s) connected. Total connections: %d", user.ID, user.Name, len(h.connections[user.ID]))
 }
 
 // unregisterConnection unregisters a connection
 func (h *Hub) unregisterConnection(conn *Connection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, conn)
+
 	user := conn.GetUser()
 	if user == nil {
 		conn.Close()
 		return
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
 	if connections, ok := h.connections[user.ID]; ok {
 		if _, exists := connections[conn]; exists {
 			delete(connections, conn)
+			h.unsubscribeAll(conn)
 			conn.Close()
 
+			// Broadcasting needs h.mu, clear typing indicators asynchronously
+			go h.clearTyping(conn)
+
+			// Last connection takes the user offline here; peers are told once
+			// the user has no connections on other instances either
 			if len(connections) == 0 {
 				delete(h.connections, user.ID)
+				delete(h.presence, user.ID)
+				if eventLog, ok := h.eventLogs[user.ID]; ok {
+					eventLog.offlineSince = time.Now()
+				}
+				h.offlineTokens[user.ID] = conn.GetToken()
+				h.queuePresence(presenceUpdate{
+					userID:   user.ID,
+					status:   models.StatusOffline,
+					announce: true,
+				})
 			}
 
 			log.Printf("User %d (%s) disconnected. Remaining connections: %d", user.ID, user.Name, len(connections))
@@ -93,68 +391,196 @@ func (h *Hub) unregisterConnection(conn *Connection) {
 	}
 }
 
-// BroadcastToChatMembers sends a message to all online chat members
+// BroadcastToChatMembers sends a message to all online chat members,
+// on every gateway instance
 func (h *Hub) BroadcastToChatMembers(chatID int, event string, data interface{}, excludeUserID *int) {
-	// Get chat members from backend
-	members, err := h.apiClient.GetChatMembers(chatID)
+	dataBytes, err := marshalData(data)
 	if err != nil {
-		log.Printf("Error getting chat members: %v", err)
+		log.Printf("Error marshaling broadcast data: %v", err)
 		return
 	}
 
-	// Prepare message
-	msg := models.WebSocketMessage{Event: event}
-	if data != nil {
-		dataBytes, err := json.Marshal(data)
-		if err != nil {
-			log.Printf("Error marshaling broadcast data: %v", err)
-			return
+	h.publish(broker.Envelope{
+		Kind:          broker.KindChat,
+		Event:         event,
+		Data:          dataBytes,
+		ChatID:        chatID,
+		ExcludeUserID: excludeUserID,
+	})
+}
+
+// SendToUsers sends a message to all connections of the given users, on
+// every gateway instance, as a single broker envelope
+func (h *Hub) SendToUsers(userIDs []int, event string, data interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	dataBytes, err := marshalData(data)
+	if err != nil {
+		log.Printf("Error marshaling user message data: %v", err)
+		return
+	}
+
+	h.publish(broker.Envelope{
+		Kind:    broker.KindUser,
+		Event:   event,
+		Data:    dataBytes,
+		UserIDs: userIDs,
+	})
+}
+
+// DisconnectUser sends session_revoked to a user's connections on every
+// gateway instance and closes them. Non-empty sessionID and token limit it
+// to the connection with that session ID and connections using that token.
+func (h *Hub) DisconnectUser(userID int, sessionID string, token string, reason string) {
+	env := broker.Envelope{
+		Kind:      broker.KindDisconnect,
+		UserIDs:   []int{userID},
+		SessionID: sessionID,
+		Reason:    reason,
+	}
+	if token != "" {
+		env.TokenHash = tokenHash(token)
+	}
+	h.publish(env)
+}
+
+// publish sends an envelope through the broker. If the broker fails, the
+// envelope is still delivered to this instance's connections.
+func (h *Hub) publish(env broker.Envelope) {
+	if err := h.broker.Publish(env); err != nil {
+		log.Printf("Error publishing %s envelope, delivering locally only: %v", env.Kind, err)
+		h.handleEnvelope(env)
+	}
+}
+
+// handleEnvelope delivers an envelope received from the broker to local connections
+func (h *Hub) handleEnvelope(env broker.Envelope) {
+	switch env.Kind {
+	case broker.KindChat:
+		h.broadcastLocal(env.ChatID, env.Event, env.Data, env.ExcludeUserID)
+	case broker.KindUser:
+		h.sendLocal(env.UserIDs, env.Event, env.Data)
+	case broker.KindPresence:
+		h.handlePresenceAnnouncement(env)
+	case broker.KindDisconnect:
+		for _, userID := range env.UserIDs {
+			if closed := h.disconnectLocal(userID, env.SessionID, env.TokenHash, env.Reason); closed > 0 {
+				log.Printf("Disconnected %d connection(s) of user %d (session %q, reason %q)",
+					closed, userID, env.SessionID, env.Reason)
+			}
 		}
-		msg.Data = dataBytes
+	default:
+		log.Printf("Ignoring envelope of unknown kind %q", env.Kind)
 	}
+}
 
-	msgBytes, err := json.Marshal(msg)
+// broadcastLocal sends a message to chat subscribers connected to this
+// instance. Durable events are also logged for subscribers who may resume.
+func (h *Hub) broadcastLocal(chatID int, event string, data json.RawMessage, excludeUserID *int) {
+	if models.IsMembershipEvent(event) {
+		h.broadcastMembershipChange(chatID, event, data, excludeUserID)
+		return
+	}
+
+	ev, err := encodeEvent(event, data)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
-	// Send to all online members
+	// Subscriptions are re-checked against the member cache, so users removed
+	// without a membership event stop receiving the chat within the cache TTL
+	members, err := h.members.UserIDs(chatID)
+	if err != nil {
+		log.Printf("Error getting chat members, delivering to current subscribers: %v", err)
+	}
+
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if err != nil || !h.hasFormerMembers(chatID, members) {
+		h.deliverToRecipients(h.chatRecipients(chatID), chatID, ev, excludeUserID)
+		h.mu.RUnlock()
+		return
+	}
+	h.mu.RUnlock()
 
-	for _, member := range members {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.syncSubscriptions(chatID, members)
+	h.deliverToRecipients(h.chatRecipients(chatID), chatID, ev, excludeUserID)
+}
+
+// broadcastMembershipChange sends a membership event to the chat's
+// subscribers and all its current members, then updates subscriptions to
+// the new members
+func (h *Hub) broadcastMembershipChange(chatID int, event string, data json.RawMessage, excludeUserID *int) {
+	ev, err := encodeEvent(event, data)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	// Every instance caches members, so each refreshes on membership changes
+	h.members.Invalidate(chatID)
+	h.chatLists.InvalidateAll()
+	members, err := h.members.UserIDs(chatID)
+	if err != nil {
+		log.Printf("Error getting chat members: %v", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Subscribers include members who were just removed
+	recipients := h.chatRecipients(chatID)
+	for userID := range members {
+		if conns, ok := h.connections[userID]; ok {
+			recipients[userID] = conns
+		}
+	}
+	// Members get it on all connections, so it isn't logged as a chat event
+	h.deliverToRecipients(recipients, 0, ev, excludeUserID)
+
+	// Keep subscriptions if the members are unknown, unless the chat is gone
+	if err == nil || event == models.EventChatDeleted {
+		h.syncSubscriptions(chatID, members)
+	}
+}
+
+// deliverToRecipients sends a message to connections grouped by user.
+// Durable events are logged once per user, also for users without
+// connections, under chatID if only the chat's subscribers receive them.
+// h.mu must be held.
+func (h *Hub) deliverToRecipients(recipients map[int]map[*Connection]bool, chatID int, ev encodedEvent, excludeUserID *int) {
+	ephemeral := models.IsEphemeralEvent(ev.event)
+
+	fanout := 0
+	defer func() { h.metrics.fanout.Observe(float64(fanout)) }()
+
+	for userID, conns := range recipients {
 		// Skip excluded user if specified
-		if excludeUserID != nil && member.UserID == *excludeUserID {
+		if excludeUserID != nil && userID == *excludeUserID {
 			continue
 		}
+		fanout += len(conns)
 
-		// Send to all connections of this user
-		if connections, ok := h.connections[member.UserID]; ok {
-			for conn := range connections {
-				select {
-				case conn.send <- msgBytes:
-				default:
-					// Buffer full, skip
-				}
-			}
+		if !ephemeral {
+			h.deliverTo(userID, chatID, conns, ev)
+			continue
 		}
-	}
-}
 
-// SendToUser sends a message to a specific user (all their connections)
-func (h *Hub) SendToUser(userID int, event string, data interface{}) {
-	msg := models.WebSocketMessage{Event: event}
-	if data != nil {
-		dataBytes, err := json.Marshal(data)
-		if err != nil {
-			log.Printf("Error marshaling user message data: %v", err)
-			return
+		// Ephemeral events aren't numbered, so all recipients share one encoding
+		for conn := range conns {
+			conn.enqueue(ev.event, ev.msg)
 		}
-		msg.Data = dataBytes
 	}
+}
 
-	msgBytes, err := json.Marshal(msg)
+// sendLocal sends a message to the users' connections on this instance
+func (h *Hub) sendLocal(userIDs []int, event string, data json.RawMessage) {
+	ev, err := encodeEvent(event, data)
 	if err != nil {
 		log.Printf("Error marshaling user message: %v", err)
 		return
@@ -163,19 +589,58 @@ func (h *Hub) SendToUser(userID int, event string, data interface{}) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	if connections, ok := h.connections[userID]; ok {
-		for conn := range connections {
-			select {
-			case conn.send <- msgBytes:
-			default:
-				// Buffer full, skip
-			}
+	ephemeral := models.IsEphemeralEvent(event)
+	for _, userID := range userIDs {
+		if !ephemeral {
+			h.deliver(userID, ev)
+			continue
 		}
+		for conn := range h.connections[userID] {
+			conn.enqueue(event, ev.msg)
+		}
+	}
+}
+
+// disconnectLocal closes a user's matching connections on this instance.
+// Returns the number of closed connections.
+func (h *Hub) disconnectLocal(userID int, sessionID string, hash string, reason string) int {
+	h.mu.RLock()
+	var targets []*Connection
+	for conn := range h.connections[userID] {
+		if sessionID != "" && conn.SessionID() != sessionID {
+			continue
+		}
+		if hash != "" && tokenHash(conn.GetToken()) != hash {
+			continue
+		}
+		targets = append(targets, conn)
+	}
+	h.mu.RUnlock()
+
+	for _, conn := range targets {
+		conn.SendMessage(models.EventSessionRevoked, models.SessionRevokedData{Reason: reason})
+		conn.CloseWithCode(models.CloseSessionRevoked, "session revoked")
 	}
+
+	return len(targets)
+}
+
+// marshalData encodes event data, keeping nil as empty
+func marshalData(data interface{}) (json.RawMessage, error) {
+	if data == nil {
+		return nil, nil
+	}
+	return json.Marshal(data)
 }
 
 // handleMessage handles incoming WebSocket messages
 func (h *Hub) handleMessage(conn *Connection, msg *models.WebSocketMessage) {
+	h.metrics.inboundEvents.Inc(inboundEventLabel(msg.Event))
+
+	if !h.allowEvent(conn, msg) {
+		return
+	}
+
 	// Handle authentication first
 	if msg.Event == models.EventAuth {
 		h.handleAuth(conn, msg)
@@ -184,10 +649,13 @@ func (h *Hub) handleMessage(conn *Connection, msg *models.WebSocketMessage) {
 
 	// All other events require authentication
 	if !conn.IsAuthenticated() {
-		conn.SendError("Authentication required")
+		conn.SendError(msg.ID, models.ErrCodeAuthRequired, "Authentication required")
 		return
 	}
 
+	// Any inbound event ends auto-away
+	h.markActive(conn)
+
 	// Route to appropriate handler
 	switch msg.Event {
 	case models.EventSendMessage:
@@ -198,8 +666,24 @@ func (h *Hub) handleMessage(conn *Connection, msg *models.WebSocketMessage) {
 		h.handleAddReaction(conn, msg)
 	case models.EventMarkRead:
 		h.handleMarkRead(conn, msg)
+	case models.EventEditMessage:
+		h.handleEditMessage(conn, msg)
+	case models.EventDeleteMessage:
+		h.handleDeleteMessage(conn, msg)
+	case models.EventGetPresence:
+		h.handleGetPresence(conn, msg)
+	case models.EventSetStatus:
+		h.handleSetStatus(conn, msg)
+	case models.EventReauth:
+		h.handleReauth(conn, msg)
+	case models.EventResume:
+		h.handleResume(conn, msg)
+	case models.EventSubscribe:
+		h.handleSubscribe(conn, msg)
+	case models.EventUnsubscribe:
+		h.handleUnsubscribe(conn, msg)
 	default:
-		conn.SendError("Unknown event type")
+		conn.SendError(msg.ID, models.ErrCodeUnknownEvent, "Unknown event type")
 	}
 }
 
@@ -207,138 +691,332 @@ func (h *Hub) handleMessage(conn *Connection, msg *models.WebSocketMessage) {
 func (h *Hub) handleAuth(conn *Connection, msg *models.WebSocketMessage) {
 	var authData models.AuthData
 	if err := json.Unmarshal(msg.Data, &authData); err != nil {
-		conn.SendError("Invalid auth data")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid auth data")
 		return
 	}
 
 	if authData.Token == "" {
-		conn.SendError("Token is required")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Token is required")
+		return
+	}
+
+	// A connection belongs to one user; tokens are swapped with reauth
+	if conn.IsAuthenticated() {
+		conn.SendError(msg.ID, models.ErrCodeAlreadyAuthenticated, "Already authenticated, use reauth to change the token")
 		return
 	}
 
 	// Validate token with backend
-	user, err := h.apiClient.ValidateToken(authData.Token)
+	user, expiresAt, err := h.apiClient.ValidateToken(authData.Token)
 	if err != nil {
 		log.Printf("Auth failed: %v", err)
-		conn.SendError("Authentication failed: " + err.Error())
+		errData := backendErrorData("Authentication failed", err)
+		if errData.Code != models.ErrCodeBackendUnavailable {
+			errData.Code = models.ErrCodeAuthFailed
+		}
+		conn.SendErrorData(msg.ID, errData)
 		return
 	}
 
-	// Set user and token
-	conn.SetUser(user, authData.Token)
+	h.authenticate(conn, msg.ID, user, authData.Token, expiresAt)
+}
 
-	// Register connection
-	h.register <- conn
+// authenticate binds a validated user to the connection and registers it
+func (h *Hub) authenticate(conn *Connection, requestID string, user *models.User, token string, expiresAt time.Time) {
+	// Set user and token, unless the connection authenticated meanwhile
+	// (e.g. an auth event racing the upgrade)
+	if !conn.bindUser(user, token, expiresAt) {
+		conn.SendError(requestID, models.ErrCodeAlreadyAuthenticated, "Already authenticated, use reauth to change the token")
+		return
+	}
+
+	// Keep the user's events from now on, so this connection can resume later
+	eventLog := h.userLog(user.ID)
+
+	// Subscribed on registration, before auth_success, so the client doesn't
+	// miss chat events
+	if h.autoSubscribe {
+		conn.initialChats = h.userChats(user.ID)
+	}
+
+	// Register connection. auth_success follows the registration, so events
+	// and requests sent after it are handled as registered.
+	h.Register(conn)
+	if !h.waitRegistered(conn) {
+		return
+	}
 
 	// Send success response
-	conn.SendMessage(models.EventAuthSuccess, models.AuthSuccessData{
-		UserID: user.ID,
-		Name:   user.Name,
-		Phone:  user.Phone,
+	conn.SendReply(requestID, models.EventAuthSuccess, models.AuthSuccessData{
+		UserID:    user.ID,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		SessionID: conn.SessionID(),
+		Epoch:     eventLog.epoch,
+		ExpiresAt: expiryUnix(expiresAt),
 	})
 
 	log.Printf("User authenticated: %d (%s)", user.ID, user.Name)
 }
 
-// handleSendMessage handles send_message event
-func (h *Hub) handleSendMessage(conn *Connection, msg *models.WebSocketMessage) {
-	var data models.SendMessageData
+// handleReauth swaps the token of an authenticated connection
+func (h *Hub) handleReauth(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.ReauthData
 	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		conn.SendError("Invalid message data")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid reauth data")
 		return
 	}
 
-	if data.ChatID <= 0 {
-		conn.SendError("Invalid chat_id")
+	if data.Token == "" {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Token is required")
 		return
 	}
 
-	// Forward to backend API
-	messageResponse, err := h.apiClient.SendMessage(conn.GetToken(), data)
+	user, expiresAt, err := h.apiClient.ValidateToken(data.Token)
 	if err != nil {
-		log.Printf("Error sending message to backend: %v", err)
-		conn.SendError("Failed to send message: " + err.Error())
+		log.Printf("Reauth failed: %v", err)
+		errData := backendErrorData("Authentication failed", err)
+		if errData.Code != models.ErrCodeBackendUnavailable {
+			errData.Code = models.ErrCodeAuthFailed
+		}
+		conn.SendErrorData(msg.ID, errData)
 		return
 	}
 
-	// Broadcast to all chat members
-	h.BroadcastToChatMembers(data.ChatID, models.EventNewMessage, json.RawMessage(messageResponse), nil)
+	// The connection is registered under its user, which can't change
+	if user.ID != conn.GetUser().ID {
+		conn.SendError(msg.ID, models.ErrCodeAuthFailed, "Token belongs to another user")
+		return
+	}
+
+	conn.SetUser(user, data.Token, expiresAt)
+
+	conn.SendReply(msg.ID, models.EventReauthSuccess, models.ReauthSuccessData{
+		ExpiresAt: expiryUnix(expiresAt),
+	})
+
+	log.Printf("User reauthenticated: %d (%s)", user.ID, user.Name)
+}
+
+// expiryUnix converts a token expiry for clients (0 if unknown)
+func expiryUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
 }
 
-// handleTyping handles typing indicator
-func (h *Hub) handleTyping(conn *Connection, msg *models.WebSocketMessage) {
-	var data models.TypingData
+// handleSendMessage handles send_message event
+func (h *Hub) handleSendMessage(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.SendMessageData
 	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		conn.SendError("Invalid typing data")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid message data")
 		return
 	}
 
-	user := conn.GetUser()
+	if data.ChatID <= 0 {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid chat_id")
+		return
+	}
 
-	// Broadcast to chat members (excluding sender)
-	typingData := models.UserTypingData{
-		ChatID:   data.ChatID,
-		UserID:   user.ID,
-		Name:     user.Name,
-		IsTyping: data.IsTyping,
+	// Forward to backend API
+	messageResponse, err := h.apiClient.SendMessage(conn.GetToken(), data)
+	if err != nil {
+		log.Printf("Error sending message to backend: %v", err)
+		conn.SendErrorData(msg.ID, chatErrorData("Failed to send message", err))
+		return
 	}
 
-	h.BroadcastToChatMembers(data.ChatID, models.EventUserTyping, typingData, &user.ID)
+	conn.SendAck(msg.ID, msg.Event, messageResponse)
+
+	// Broadcast to all chat members
+	h.BroadcastToChatMembers(data.ChatID, models.EventNewMessage, json.RawMessage(messageResponse), nil)
 }
 
 // handleAddReaction handles add_reaction event
 func (h *Hub) handleAddReaction(conn *Connection, msg *models.WebSocketMessage) {
 	var data models.AddReactionData
 	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		conn.SendError("Invalid reaction data")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid reaction data")
 		return
 	}
 
 	// Forward to backend API
 	if err := h.apiClient.AddReaction(conn.GetToken(), data); err != nil {
 		log.Printf("Error adding reaction: %v", err)
-		conn.SendError("Failed to add reaction: " + err.Error())
+		conn.SendErrorData(msg.ID, chatErrorData("Failed to add reaction", err))
+		return
+	}
+
+	conn.SendAck(msg.ID, msg.Event, nil)
+
+	// Resolve the message's chat so every member sees the reaction
+	chats, err := h.apiClient.GetMessageChats([]int{data.MessageID})
+	if err != nil {
+		log.Printf("Error resolving chat for message %d: %v", data.MessageID, err)
+		return
+	}
+
+	chatID, ok := chats[data.MessageID]
+	if !ok {
+		log.Printf("Chat not found for message %d", data.MessageID)
 		return
 	}
 
-	// Note: We need to get chat_id from backend or pass it in the event
-	// For now, we'll send success to the sender
 	user := conn.GetUser()
 	reactionData := models.NewReactionData{
+		ChatID:    chatID,
 		MessageID: data.MessageID,
 		UserID:    user.ID,
 		Name:      user.Name,
 		Emoji:     data.Emoji,
 	}
 
-	// TODO: Get chat_id from message and broadcast to chat members
-	// For now, just confirm to sender
-	conn.SendMessage(models.EventNewReaction, reactionData)
+	// Broadcast to all chat members (including the reactor's other devices)
+	h.BroadcastToChatMembers(chatID, models.EventNewReaction, reactionData, nil)
 }
 
 // handleMarkRead handles mark_read event
 func (h *Hub) handleMarkRead(conn *Connection, msg *models.WebSocketMessage) {
 	var data models.MarkReadData
 	if err := json.Unmarshal(msg.Data, &data); err != nil {
-		conn.SendError("Invalid read data")
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid read data")
+		return
+	}
+
+	if len(data.MessageIDs) == 0 {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "message_ids is required")
 		return
 	}
 
 	// Forward to backend API
 	if err := h.apiClient.MarkAsRead(conn.GetToken(), data); err != nil {
 		log.Printf("Error marking as read: %v", err)
-		conn.SendError("Failed to mark as read: " + err.Error())
+		conn.SendErrorData(msg.ID, chatErrorData("Failed to mark as read", err))
 		return
 	}
 
+	conn.SendAck(msg.ID, msg.Event, nil)
+
+	// Group read messages by chat
+	chats, err := h.apiClient.GetMessageChats(data.MessageIDs)
+	if err != nil {
+		log.Printf("Error resolving chats for read messages: %v", err)
+		return
+	}
+
+	byChat := make(map[int][]int)
+	for _, messageID := range data.MessageIDs {
+		chatID, ok := chats[messageID]
+		if !ok {
+			continue
+		}
+		byChat[chatID] = append(byChat[chatID], messageID)
+	}
+
+	// Broadcast one read event per chat to its members. The backend marks
+	// messages read without checking membership, so receipts go only into
+	// the user's own chats.
 	user := conn.GetUser()
-	readData := models.MessageReadData{
-		MessageIDs: data.MessageIDs,
-		UserID:     user.ID,
-		Name:       user.Name,
+	for chatID, messageIDs := range byChat {
+		isMember, err := h.members.IsMember(chatID, user.ID)
+		if err != nil {
+			log.Printf("Error checking membership of user %d in chat %d: %v", user.ID, chatID, err)
+			continue
+		}
+		if !isMember {
+			continue
+		}
+
+		readData := models.MessageReadData{
+			ChatID:     chatID,
+			MessageIDs: messageIDs,
+			UserID:     user.ID,
+			Name:       user.Name,
+		}
+
+		h.BroadcastToChatMembers(chatID, models.EventMessageRead, readData, nil)
+	}
+}
+
+// handleEditMessage handles edit_message event
+func (h *Hub) handleEditMessage(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.EditMessageData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid edit data")
+		return
+	}
+
+	if data.MessageID <= 0 {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid message_id")
+		return
 	}
 
-	// TODO: Get chat_id from messages and broadcast to chat members
-	// For now, just confirm to sender
-	conn.SendMessage(models.EventMessageRead, readData)
+	// Forward to backend API
+	messageResponse, err := h.apiClient.UpdateMessage(conn.GetToken(), data)
+	if err != nil {
+		log.Printf("Error updating message: %v", err)
+		conn.SendBackendError(msg.ID, "Failed to edit message", err)
+		return
+	}
+
+	conn.SendAck(msg.ID, msg.Event, messageResponse)
+
+	// The updated message carries its chat_id
+	var message struct {
+		ChatID int `json:"chat_id"`
+	}
+	if err := json.Unmarshal(messageResponse, &message); err != nil || message.ChatID <= 0 {
+		log.Printf("Error reading chat_id of edited message %d: %v", data.MessageID, err)
+		return
+	}
+
+	// Broadcast to all chat members
+	h.BroadcastToChatMembers(message.ChatID, models.EventMessageEdited, json.RawMessage(messageResponse), nil)
+}
+
+// handleDeleteMessage handles delete_message event
+func (h *Hub) handleDeleteMessage(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.DeleteMessageData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid delete data")
+		return
+	}
+
+	if data.MessageID <= 0 {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid message_id")
+		return
+	}
+
+	// Forward to backend API first, so only the author learns about the message
+	if err := h.apiClient.DeleteMessage(conn.GetToken(), data.MessageID); err != nil {
+		log.Printf("Error deleting message: %v", err)
+		conn.SendBackendError(msg.ID, "Failed to delete message", err)
+		return
+	}
+
+	conn.SendAck(msg.ID, msg.Event, nil)
+
+	// Deletes are soft, the message still resolves to its chat
+	chats, err := h.apiClient.GetMessageChats([]int{data.MessageID})
+	if err != nil {
+		log.Printf("Error resolving chat for message %d: %v", data.MessageID, err)
+		return
+	}
+
+	chatID, ok := chats[data.MessageID]
+	if !ok {
+		log.Printf("Chat not found for deleted message %d", data.MessageID)
+		return
+	}
+
+	user := conn.GetUser()
+	deletedData := models.MessageDeletedData{
+		ChatID:    chatID,
+		MessageID: data.MessageID,
+		UserID:    user.ID,
+	}
+
+	// Broadcast to all chat members
+	h.BroadcastToChatMembers(chatID, models.EventMessageDeleted, deletedData, nil)
 }
@@ -0,0 +1,265 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// memberCacheEntry holds cached members of a single chat
+type memberCacheEntry struct {
+	members   []models.ChatMember
+	userIDs   map[int]struct{}
+	expiresAt time.Time
+}
+
+// memberLoad is a backend load in flight, shared by concurrent misses
+type memberLoad struct {
+	done  chan struct{}
+	entry memberCacheEntry
+	err   error
+}
+
+// memberCache caches chat members fetched from the backend with a TTL.
+// Entries are dropped on expiry or explicit invalidation. Concurrent misses
+// of a chat share one backend load.
+type memberCache struct {
+	ttl  time.Duration
+	load func(chatID int) ([]models.ChatMember, error)
+
+	mu      sync.RWMutex
+	entries map[int]memberCacheEntry
+
+	// Loads in flight (chatID -> load); guarded by mu
+	loading map[int]*memberLoad
+
+	// Bumped on every invalidation so in-flight loads don't store stale data
+	generation atomic.Uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// newMemberCache creates a member cache; a zero ttl disables caching
+func newMemberCache(ttl time.Duration, load func(chatID int) ([]models.ChatMember, error)) *memberCache {
+	return &memberCache{
+		ttl:     ttl,
+		load:    load,
+		entries: make(map[int]memberCacheEntry),
+		loading: make(map[int]*memberLoad),
+	}
+}
+
+// Get returns chat members, loading them from the backend on a miss
+func (c *memberCache) Get(chatID int) ([]models.ChatMember, error) {
+	entry, err := c.entry(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.members, nil
+}
+
+// IsMember reports whether the user is a member of the chat
+func (c *memberCache) IsMember(chatID, userID int) (bool, error) {
+	entry, err := c.entry(chatID)
+	if err != nil {
+		return false, err
+	}
+	_, ok := entry.userIDs[userID]
+	return ok, nil
+}
+
+// UserIDs returns the set of member user IDs of the chat. The set is shared
+// with the cache and must not be modified.
+func (c *memberCache) UserIDs(chatID int) (map[int]struct{}, error) {
+	entry, err := c.entry(chatID)
+	if err != nil {
+		return nil, err
+	}
+	return entry.userIDs, nil
+}
+
+// entry returns the cached entry of a chat, loading it on a miss
+func (c *memberCache) entry(chatID int) (memberCacheEntry, error) {
+	if c.ttl > 0 {
+		c.mu.RLock()
+		entry, ok := c.entries[chatID]
+		c.mu.RUnlock()
+
+		if ok && time.Now().Before(entry.expiresAt) {
+			c.hits.Add(1)
+			return entry, nil
+		}
+	}
+
+	c.mu.Lock()
+	// Another miss may have loaded the chat meanwhile
+	if entry, ok := c.entries[chatID]; ok && c.ttl > 0 && time.Now().Before(entry.expiresAt) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return entry, nil
+	}
+	c.misses.Add(1)
+	if load, ok := c.loading[chatID]; ok {
+		c.mu.Unlock()
+		<-load.done
+		return load.entry, load.err
+	}
+	load := &memberLoad{done: make(chan struct{})}
+	c.loading[chatID] = load
+	generation := c.generation.Load()
+	c.mu.Unlock()
+
+	load.entry, load.err = c.fetch(chatID, generation)
+
+	c.mu.Lock()
+	if c.loading[chatID] == load {
+		delete(c.loading, chatID)
+	}
+	c.mu.Unlock()
+	close(load.done)
+
+	return load.entry, load.err
+}
+
+// fetch loads a chat's members from the backend and caches them unless the
+// cache was invalidated since generation
+func (c *memberCache) fetch(chatID int, generation uint64) (memberCacheEntry, error) {
+	members, err := c.load(chatID)
+	if err != nil {
+		return memberCacheEntry{}, err
+	}
+
+	entry := memberCacheEntry{
+		members:   members,
+		userIDs:   make(map[int]struct{}, len(members)),
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	for _, member := range members {
+		entry.userIDs[member.UserID] = struct{}{}
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if c.generation.Load() == generation {
+			c.entries[chatID] = entry
+		}
+		c.mu.Unlock()
+	}
+
+	return entry, nil
+}
+
+// Invalidate drops cached members of a chat
+func (c *memberCache) Invalidate(chatID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation.Add(1)
+	delete(c.entries, chatID)
+
+	// Later misses must not join a load started before the change
+	delete(c.loading, chatID)
+}
+
+// PurgeExpired drops all expired entries
+func (c *memberCache) PurgeExpired() {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for chatID, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, chatID)
+		}
+	}
+}
+
+// Stats returns cache hit and miss counters
+func (c *memberCache) Stats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// chatListEntry holds the cached chat IDs of a single user
+type chatListEntry struct {
+	chatIDs   []int
+	expiresAt time.Time
+}
+
+// chatListCache caches the chats each user is a member of with a TTL.
+// Membership changes drop all entries, as they may affect any member.
+type chatListCache struct {
+	ttl  time.Duration
+	load func(userID int) ([]int, error)
+
+	mu      sync.RWMutex
+	entries map[int]chatListEntry
+
+	// Bumped on every invalidation so in-flight loads don't store stale data
+	generation atomic.Uint64
+}
+
+// newChatListCache creates a chat list cache; a zero ttl disables caching
+func newChatListCache(ttl time.Duration, load func(userID int) ([]int, error)) *chatListCache {
+	return &chatListCache{
+		ttl:     ttl,
+		load:    load,
+		entries: make(map[int]chatListEntry),
+	}
+}
+
+// Get returns the user's chat IDs, loading them from the backend on a miss.
+// The slice is shared with the cache and must not be modified.
+func (c *chatListCache) Get(userID int) ([]int, error) {
+	if c.ttl > 0 {
+		c.mu.RLock()
+		entry, ok := c.entries[userID]
+		c.mu.RUnlock()
+
+		if ok && time.Now().Before(entry.expiresAt) {
+			return entry.chatIDs, nil
+		}
+	}
+
+	generation := c.generation.Load()
+	chatIDs, err := c.load(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if c.generation.Load() == generation {
+			c.entries[userID] = chatListEntry{chatIDs: chatIDs, expiresAt: time.Now().Add(c.ttl)}
+		}
+		c.mu.Unlock()
+	}
+
+	return chatIDs, nil
+}
+
+// InvalidateAll drops all cached chat lists
+func (c *chatListCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation.Add(1)
+	c.entries = make(map[int]chatListEntry)
+}
+
+// PurgeExpired drops all expired entries
+func (c *chatListCache) PurgeExpired() {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for userID, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, userID)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+func TestMemberCacheSharesLoads(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	cache := newMemberCache(time.Minute, func(chatID int) ([]models.ChatMember, error) {
+		loads.Add(1)
+		<-release
+		return []models.ChatMember{{UserID: 1}, {UserID: 2}}, nil
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			isMember, err := cache.IsMember(5, 2)
+			if err == nil && !isMember {
+				t.Error("user 2 is not a member")
+			}
+			errs <- err
+		}()
+	}
+
+	// Let the misses pile up on the first load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("backend loaded %d times, want 1", n)
+	}
+}
+
+func TestMemberCacheInvalidateDuringLoad(t *testing.T) {
+	var loads atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cache := newMemberCache(time.Minute, func(chatID int) ([]models.ChatMember, error) {
+		if loads.Add(1) == 1 {
+			close(started)
+			<-release
+			return []models.ChatMember{{UserID: 1}}, nil
+		}
+		return []models.ChatMember{{UserID: 1}, {UserID: 2}}, nil
+	})
+
+	go cache.Get(5)
+	<-started
+	cache.Invalidate(5)
+
+	// A miss after the invalidation doesn't join the stale load
+	isMember, err := cache.IsMember(5, 2)
+	close(release)
+	if err != nil || !isMember {
+		t.Errorf("IsMember = %v, %v, want true", isMember, err)
+	}
+}
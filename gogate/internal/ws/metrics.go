@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"buzzchat-gogate/internal/metrics"
+	"buzzchat-gogate/internal/models"
+)
+
+// fanoutBuckets are histogram buckets for connections reached per chat broadcast
+var fanoutBuckets = []float64{0, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+
+// hubMetrics are the metrics updated by the hub and its connections
+type hubMetrics struct {
+	inboundEvents  *metrics.Counter
+	outboundFrames *metrics.Counter
+	fanout         *metrics.Histogram
+}
+
+// newHubMetrics registers the hub's metrics, including ones read from hub
+// state on every scrape
+func newHubMetrics(reg *metrics.Registry, h *Hub) *hubMetrics {
+	reg.NewGaugeFunc("gogate_connections",
+		"Open WebSocket connections, including unauthenticated ones.",
+		func() float64 {
+			h.mu.RLock()
+			defer h.mu.RUnlock()
+			return float64(len(h.clients))
+		})
+
+	reg.NewGaugeFunc("gogate_authenticated_users",
+		"Users with at least one authenticated connection.",
+		func() float64 {
+			h.mu.RLock()
+			defer h.mu.RUnlock()
+			return float64(len(h.connections))
+		})
+
+	reg.NewCounterFunc("gogate_dropped_messages_total",
+		"Outbound messages dropped for slow clients, per event type.", "event",
+		func() map[string]float64 {
+			values := make(map[string]float64)
+			for event, count := range h.DropStats() {
+				values[event] = float64(count)
+			}
+			return values
+		})
+
+	reg.NewCounterFunc("gogate_member_cache_requests_total",
+		"Chat member cache lookups, by result (hit or miss).", "result",
+		func() map[string]float64 {
+			hits, misses := h.MemberCacheStats()
+			return map[string]float64{"hit": float64(hits), "miss": float64(misses)}
+		})
+
+	return &hubMetrics{
+		inboundEvents: reg.NewCounter("gogate_inbound_events_total",
+			"Events received from clients, per event type.", "event"),
+		outboundFrames: reg.NewCounter("gogate_outbound_frames_total",
+			"WebSocket frames written to clients."),
+		fanout: reg.NewHistogram("gogate_broadcast_fanout",
+			"Connections reached per chat broadcast on this instance.", fanoutBuckets),
+	}
+}
+
+// inboundEventLabel limits the event label to known client events, so
+// clients can't create arbitrary series
+func inboundEventLabel(event string) string {
+	if models.IsClientEvent(event) {
+		return event
+	}
+	return "unknown"
+}
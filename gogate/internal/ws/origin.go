@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originWildcard matches any subdomain of a host, e.g. https://*.example.com
+type originWildcard struct {
+	scheme string // empty matches http and https
+	suffix string // ".example.com"
+	port   string
+}
+
+// originPolicy decides which browser origins may open WebSocket connections
+type originPolicy struct {
+	allowAll  bool
+	exact     map[string]bool
+	wildcards []originWildcard
+}
+
+// newOriginPolicy builds a policy from allowed origin patterns.
+// Patterns are exact origins ("https://chat.example.com") or wildcard
+// subdomains ("https://*.example.com"); the scheme may be omitted to
+// allow both http and https.
+func newOriginPolicy(patterns []string, allowAll bool) (*originPolicy, error) {
+	policy := &originPolicy{
+		allowAll: allowAll,
+		exact:    make(map[string]bool),
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+
+		scheme, hostport := "", pattern
+		if i := strings.Index(pattern, "://"); i >= 0 {
+			scheme, hostport = pattern[:i], pattern[i+3:]
+			if scheme != "http" && scheme != "https" {
+				return nil, fmt.Errorf("invalid origin %q: scheme must be http or https", pattern)
+			}
+		}
+		hostport = strings.TrimSuffix(hostport, "/")
+		if hostport == "" || strings.Contains(hostport, "/") {
+			return nil, fmt.Errorf("invalid origin %q", pattern)
+		}
+
+		host, port := splitHostPort(hostport)
+
+		if strings.HasPrefix(host, "*.") {
+			policy.wildcards = append(policy.wildcards, originWildcard{
+				scheme: scheme,
+				suffix: host[1:],
+				port:   port,
+			})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid origin %q: only leading *. wildcards are supported", pattern)
+		}
+
+		if scheme == "" {
+			policy.exact["http://"+hostport] = true
+			policy.exact["https://"+hostport] = true
+		} else {
+			policy.exact[scheme+"://"+hostport] = true
+		}
+	}
+
+	return policy, nil
+}
+
+// check reports whether the request's origin is allowed, with a reason if not.
+// Requests without an Origin header come from non-browser clients and are
+// not subject to cross-site WebSocket hijacking, so they are allowed.
+func (p *originPolicy) check(r *http.Request) (bool, string) {
+	if p.allowAll {
+		return true, ""
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true, ""
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Host == "" {
+		return false, fmt.Sprintf("malformed origin %q", origin)
+	}
+
+	if p.exact[u.Scheme+"://"+u.Host] {
+		return true, ""
+	}
+
+	host, port := splitHostPort(u.Host)
+	for _, wildcard := range p.wildcards {
+		if wildcard.scheme != "" && wildcard.scheme != u.Scheme {
+			continue
+		}
+		if wildcard.port != port {
+			continue
+		}
+		if strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return true, ""
+		}
+	}
+
+	return false, fmt.Sprintf("origin %q is not allowed", origin)
+}
+
+// splitHostPort splits "host:port" without requiring a port
+func splitHostPort(hostport string) (host, port string) {
+	if i := strings.LastIndex(hostport, ":"); i >= 0 && !strings.Contains(hostport[i:], "]") {
+		return hostport[:i], hostport[i+1:]
+	}
+	return hostport, ""
+}
@@ -0,0 +1,106 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewOriginPolicyInvalid(t *testing.T) {
+	patterns := []string{
+		"ftp://chat.example.com",
+		"https://",
+		"https://chat.example.com/app",
+		"https://chat.*.com",
+		"https://a*.example.com",
+	}
+
+	for _, pattern := range patterns {
+		if _, err := newOriginPolicy([]string{pattern}, false); err == nil {
+			t.Errorf("newOriginPolicy(%q) succeeded, want error", pattern)
+		}
+	}
+}
+
+func TestOriginPolicyCheck(t *testing.T) {
+	patterns := []string{
+		"https://chat.example.com/",
+		"https://*.apps.example.com",
+		"*.preview.example.com:8443",
+		"localhost:5173",
+		"http://[::1]:3000",
+		"HTTPS://Upper.Example.com",
+		"",
+	}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		// No Origin header: not a browser
+		{"", true},
+
+		// Exact origins
+		{"https://chat.example.com", true},
+		{"http://chat.example.com", false},
+		{"https://chat.example.com:8443", false},
+		{"https://chat.example.com.evil.com", false},
+		{"https://upper.example.com", true},
+		{"https://UPPER.example.com", true},
+
+		// Wildcards match subdomains, not the bare domain
+		{"https://a.apps.example.com", true},
+		{"https://a.b.apps.example.com", true},
+		{"https://apps.example.com", false},
+		{"https://evilapps.example.com", false},
+		{"http://a.apps.example.com", false},
+		{"https://a.apps.example.com:8443", false},
+
+		// Scheme-less patterns allow http and https, ports must match
+		{"http://localhost:5173", true},
+		{"https://localhost:5173", true},
+		{"http://localhost:5174", false},
+		{"http://localhost", false},
+		{"http://a.preview.example.com:8443", true},
+		{"https://a.preview.example.com:8443", true},
+		{"https://a.preview.example.com", false},
+
+		// IPv6 hosts
+		{"http://[::1]:3000", true},
+		{"http://[::1]", false},
+		{"http://[::2]:3000", false},
+
+		// Opaque and malformed origins
+		{"null", false},
+		{"http://[::1", false},
+		{"chat.example.com", false},
+	}
+
+	policy, err := newOriginPolicy(patterns, false)
+	if err != nil {
+		t.Fatalf("newOriginPolicy failed: %v", err)
+	}
+	devPolicy, err := newOriginPolicy(nil, true)
+	if err != nil {
+		t.Fatalf("newOriginPolicy failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+
+		got, reason := policy.check(r)
+		if got != tt.want {
+			t.Errorf("check(%q) = %v (%s), want %v", tt.origin, got, reason, tt.want)
+		}
+		if !got && reason == "" {
+			t.Errorf("check(%q) rejected without a reason", tt.origin)
+		}
+
+		// Dev mode allows every origin
+		if ok, _ := devPolicy.check(r); !ok {
+			t.Errorf("dev mode check(%q) = false, want true", tt.origin)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"buzzchat-gogate/internal/broker"
+	"buzzchat-gogate/internal/models"
+)
+
+// presenceQueueSize is the number of pending presence updates
+const presenceQueueSize = 1024
+
+// presenceAnnouncePeriod is how often an instance announces its online users
+// to the others; announcements expire after presenceAnnounceTTL, so users
+// of a crashed instance don't stay online forever
+const (
+	presenceAnnouncePeriod = 30 * time.Second
+	presenceAnnounceTTL    = 3 * presenceAnnouncePeriod
+)
+
+// maxCustomStatusLength limits the custom status text
+const maxCustomStatusLength = 100
+
+// maxPresenceUsers limits the user IDs in one get_presence event
+const maxPresenceUsers = 200
+
+// presenceState is the current status of an online user
+type presenceState struct {
+	status     string
+	customText string
+
+	// Set when the status was changed by idle detection rather than the user
+	auto bool
+}
+
+// presenceUpdate is a queued status change of a user
+type presenceUpdate struct {
+	userID     int
+	token      string
+	status     string
+	customText string
+
+	// Set to announce that the user came online or went offline on this
+	// instance, instead of notifying peers directly
+	announce bool
+}
+
+// queuePresence schedules a presence update without blocking the caller
+func (h *Hub) queuePresence(update presenceUpdate) {
+	select {
+	case h.presenceUpdates <- update:
+	default:
+		log.Printf("Presence queue full, dropping %s update for user %d", update.status, update.userID)
+	}
+}
+
+// presenceLoop processes presence updates in order until the hub stops.
+// Periodic announcements run in the same loop so they never overtake a
+// queued offline announcement.
+func (h *Hub) presenceLoop() {
+	ticker := time.NewTicker(presenceAnnouncePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case update := <-h.presenceUpdates:
+			if update.announce {
+				h.announcePresence([]int{update.userID}, update.status != models.StatusOffline)
+				continue
+			}
+			h.publishPresence(update)
+		case <-ticker.C:
+			h.announceOnlineUsers()
+		case <-h.quit:
+			// The broker is closed after shutdown, other instances expire
+			// this instance's announcements
+			return
+		}
+	}
+}
+
+// announcePresence tells all instances, including this one, that users came
+// online or went offline here
+func (h *Hub) announcePresence(userIDs []int, online bool) {
+	h.publish(broker.Envelope{
+		Kind:     broker.KindPresence,
+		UserIDs:  userIDs,
+		Instance: h.instanceID,
+		Online:   online,
+	})
+}
+
+// announceOnlineUsers refreshes the presence of this instance's users on
+// the others and forgets remote users whose announcements expired
+func (h *Hub) announceOnlineUsers() {
+	h.mu.Lock()
+	userIDs := make([]int, 0, len(h.connections))
+	for userID := range h.connections {
+		userIDs = append(userIDs, userID)
+	}
+
+	cutoff := time.Now().Add(-presenceAnnounceTTL)
+	for userID, instances := range h.remotePresence {
+		for instance, seen := range instances {
+			if seen.Before(cutoff) {
+				delete(instances, instance)
+			}
+		}
+		if len(instances) == 0 {
+			delete(h.remotePresence, userID)
+		}
+	}
+	h.mu.Unlock()
+
+	if len(userIDs) > 0 {
+		h.announcePresence(userIDs, true)
+	}
+}
+
+// handlePresenceAnnouncement tracks users of other instances. When this
+// instance's own offline announcement comes back, the broker has delivered
+// everything announced before it, so the user is offline on all instances
+// unless one of them still lists the user.
+func (h *Hub) handlePresenceAnnouncement(env broker.Envelope) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for _, userID := range env.UserIDs {
+		if env.Instance != h.instanceID {
+			if env.Online {
+				if h.remotePresence[userID] == nil {
+					h.remotePresence[userID] = make(map[string]time.Time)
+				}
+				h.remotePresence[userID][env.Instance] = now
+			} else if instances, ok := h.remotePresence[userID]; ok {
+				delete(instances, env.Instance)
+				if len(instances) == 0 {
+					delete(h.remotePresence, userID)
+				}
+			}
+			continue
+		}
+
+		if env.Online {
+			continue
+		}
+		token, ok := h.offlineTokens[userID]
+		delete(h.offlineTokens, userID)
+		if !ok || len(h.connections[userID]) > 0 || h.onlineElsewhere(userID, now) {
+			continue
+		}
+		h.queuePresence(presenceUpdate{
+			userID: userID,
+			token:  token,
+			status: models.StatusOffline,
+		})
+	}
+}
+
+// onlineElsewhere reports whether another instance recently announced the
+// user as online. Must be called with h.mu held.
+func (h *Hub) onlineElsewhere(userID int, now time.Time) bool {
+	for _, seen := range h.remotePresence[userID] {
+		if now.Sub(seen) < presenceAnnounceTTL {
+			return true
+		}
+	}
+	return false
+}
+
+// publishPresence reports the status to backend and notifies chat peers
+func (h *Hub) publishPresence(update presenceUpdate) {
+	if h.reportPresence && update.token != "" {
+		if err := h.apiClient.UpdateOnlineStatus(update.token, update.status); err != nil {
+			log.Printf("Error reporting status %s for user %d: %v", update.status, update.userID, err)
+		}
+	}
+
+	h.sendToChatPeers(update.userID, models.EventPresenceChanged, models.PresenceData{
+		UserID:     update.userID,
+		Status:     update.status,
+		CustomText: update.customText,
+	})
+}
+
+// sendToChatPeers sends a message to every online user sharing a chat with userID
+func (h *Hub) sendToChatPeers(userID int, event string, data interface{}) {
+	peers, err := h.chatPeers(userID)
+	if err != nil {
+		log.Printf("Error getting chats of user %d: %v", userID, err)
+		return
+	}
+
+	peerIDs := make([]int, 0, len(peers))
+	for peerID := range peers {
+		peerIDs = append(peerIDs, peerID)
+	}
+
+	// One envelope for all peers, rather than a broker publish per peer
+	h.SendToUsers(peerIDs, event, data)
+}
+
+// chatPeers returns the users sharing a chat with userID, excluding the
+// user. Chats whose members can't be loaded are skipped.
+func (h *Hub) chatPeers(userID int) (map[int]bool, error) {
+	chatIDs, err := h.chatLists.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[int]bool)
+	for _, chatID := range chatIDs {
+		members, err := h.members.Get(chatID)
+		if err != nil {
+			log.Printf("Error getting chat members: %v", err)
+			continue
+		}
+
+		for _, member := range members {
+			if member.UserID != userID {
+				peers[member.UserID] = true
+			}
+		}
+	}
+	return peers, nil
+}
+
+// sharedChatUsers returns which of userIDs share a chat with userID. Chats
+// are checked until all of them are found, so a request for close contacts
+// rarely loads every chat of the user.
+func (h *Hub) sharedChatUsers(userID int, userIDs []int) (map[int]bool, error) {
+	chatIDs, err := h.chatLists.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make(map[int]bool, len(userIDs))
+	for _, id := range userIDs {
+		if id != userID {
+			pending[id] = true
+		}
+	}
+
+	found := make(map[int]bool, len(pending))
+	for _, chatID := range chatIDs {
+		if len(pending) == 0 {
+			break
+		}
+
+		members, err := h.members.UserIDs(chatID)
+		if err != nil {
+			log.Printf("Error getting chat members: %v", err)
+			continue
+		}
+
+		for id := range pending {
+			if _, ok := members[id]; ok {
+				found[id] = true
+				delete(pending, id)
+			}
+		}
+	}
+	return found, nil
+}
+
+// GetPresence returns the current status of a user. Announcements from
+// other instances don't carry the status, so users connected only there
+// are reported as available.
+func (h *Hub) GetPresence(userID int) models.PresenceData {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	data := models.PresenceData{UserID: userID, Status: models.StatusOffline}
+	if state, ok := h.presence[userID]; ok {
+		data.Status = state.status
+		data.CustomText = state.customText
+	} else if h.onlineElsewhere(userID, time.Now()) {
+		data.Status = models.StatusAvailable
+	}
+	return data
+}
+
+// setPresence updates a user's status and queues the change if it differs.
+// Must be called with h.mu held.
+func (h *Hub) setPresence(userID int, token string, state presenceState) {
+	current, ok := h.presence[userID]
+	h.presence[userID] = state
+
+	if ok && current.status == state.status && current.customText == state.customText {
+		return
+	}
+
+	h.queuePresence(presenceUpdate{
+		userID:     userID,
+		token:      token,
+		status:     state.status,
+		customText: state.customText,
+	})
+}
+
+// markActive brings a user back from auto-away on inbound activity
+func (h *Hub) markActive(conn *Connection) {
+	user := conn.GetUser()
+
+	h.mu.RLock()
+	state, ok := h.presence[user.ID]
+	h.mu.RUnlock()
+
+	if !ok || !state.auto {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Re-check under write lock, the user may have changed status meanwhile
+	if state, ok := h.presence[user.ID]; ok && state.auto {
+		h.setPresence(user.ID, conn.GetToken(), presenceState{status: models.StatusAvailable})
+	}
+}
+
+// checkIdle switches available users to away when none of their
+// connections sent a frame within the auto-away period
+func (h *Hub) checkIdle() {
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for userID, connections := range h.connections {
+		state, ok := h.presence[userID]
+		if !ok || state.status != models.StatusAvailable {
+			continue
+		}
+
+		var lastActivity time.Time
+		var token string
+		for conn := range connections {
+			if activity := conn.LastActivity(); activity.After(lastActivity) {
+				lastActivity = activity
+				token = conn.GetToken()
+			}
+		}
+
+		if now.Sub(lastActivity) >= h.autoAwayAfter {
+			h.setPresence(userID, token, presenceState{status: models.StatusAway, auto: true})
+		}
+	}
+}
+
+// handleGetPresence handles get_presence event
+func (h *Hub) handleGetPresence(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.GetPresenceData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid presence data")
+		return
+	}
+
+	if len(data.UserIDs) == 0 || len(data.UserIDs) > maxPresenceUsers {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload,
+			fmt.Sprintf("user_ids must contain 1 to %d user IDs", maxPresenceUsers))
+		return
+	}
+
+	// Presence is only visible to users sharing a chat
+	user := conn.GetUser()
+	peers, err := h.sharedChatUsers(user.ID, data.UserIDs)
+	if err != nil {
+		log.Printf("Error getting chats of user %d: %v", user.ID, err)
+		conn.SendBackendError(msg.ID, "Failed to get presence", err)
+		return
+	}
+
+	users := make([]models.PresenceData, 0, len(data.UserIDs))
+	for _, userID := range data.UserIDs {
+		if userID != user.ID && !peers[userID] {
+			continue
+		}
+		users = append(users, h.GetPresence(userID))
+	}
+
+	conn.SendReply(msg.ID, models.EventPresence, models.PresenceListData{Users: users})
+}
+
+// handleSetStatus handles set_status event
+func (h *Hub) handleSetStatus(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.SetStatusData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid status data")
+		return
+	}
+
+	if !models.IsValidStatus(data.Status) {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid status")
+		return
+	}
+
+	if len([]rune(data.CustomText)) > maxCustomStatusLength {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Custom status text is too long")
+		return
+	}
+
+	user := conn.GetUser()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// The user may have disconnected meanwhile
+	if _, ok := h.presence[user.ID]; !ok {
+		return
+	}
+
+	h.setPresence(user.ID, conn.GetToken(), presenceState{
+		status:     data.Status,
+		customText: data.CustomText,
+	})
+}
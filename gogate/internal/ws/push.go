@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// maxPushBodySize limits the size of a push request body
+const maxPushBodySize = 1 << 20 // 1MB
+
+// PushHandler lets the backend publish events through the gateway
+type PushHandler struct {
+	hub    *Hub
+	apiKey string
+}
+
+// NewPushHandler creates a new push handler guarded by the internal API key
+func NewPushHandler(hub *Hub, apiKey string) *PushHandler {
+	return &PushHandler{
+		hub:    hub,
+		apiKey: apiKey,
+	}
+}
+
+// ServeHTTP handles push requests from the backend
+func (h *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !checkInternalAPIKey(r, h.apiKey) {
+		writeJSONError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+
+	var req models.PushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBodySize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body")
+		return
+	}
+
+	if req.Event == "" {
+		writeJSONError(w, http.StatusBadRequest, "event is required")
+		return
+	}
+
+	if (req.ChatID > 0) == (len(req.UserIDs) > 0) {
+		writeJSONError(w, http.StatusBadRequest, "Exactly one of chat_id or user_ids is required")
+		return
+	}
+
+	var data interface{}
+	if len(req.Data) > 0 {
+		data = req.Data
+	}
+
+	if req.ChatID > 0 {
+		h.hub.BroadcastToChatMembers(req.ChatID, req.Event, data, req.ExcludeUserID)
+	} else {
+		h.hub.SendToUsers(req.UserIDs, req.Event, data)
+	}
+
+	log.Printf("Pushed %s event (chat %d, users %v)", req.Event, req.ChatID, req.UserIDs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"status":"accepted"}`))
+}
+
+// checkInternalAPIKey verifies the X-Internal-API-Key header
+func checkInternalAPIKey(r *http.Request, apiKey string) bool {
+	key := r.Header.Get("X-Internal-API-Key")
+	if key == "" || apiKey == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1
+}
+
+// writeJSONError writes an error response in the backend's {"error": ...} format
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	body, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
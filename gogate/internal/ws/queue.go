@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// outbound is an encoded message waiting for the write pump
+type outbound struct {
+	event string
+	data  []byte
+}
+
+// ephemeralQueue buffers ephemeral events (typing) separately from the send
+// channel. When full, the oldest event is dropped to make room, so a slow
+// client only ever misses stale indicators.
+type ephemeralQueue struct {
+	size int
+
+	mu    sync.Mutex
+	items []outbound
+
+	// Signals the write pump that items are pending (capacity 1)
+	ready chan struct{}
+}
+
+// newEphemeralQueue creates an ephemeral queue holding up to size events
+func newEphemeralQueue(size int) *ephemeralQueue {
+	return &ephemeralQueue{
+		size:  size,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// push adds an event, returning the event dropped to make room (if any)
+func (q *ephemeralQueue) push(msg outbound) (dropped outbound, ok bool) {
+	q.mu.Lock()
+	if len(q.items) >= q.size {
+		dropped, ok = q.items[0], true
+		q.items = q.items[1:]
+	}
+	q.items = append(q.items, msg)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped, ok
+}
+
+// drain removes and returns all pending events
+func (q *ephemeralQueue) drain() []outbound {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// dropCounter counts outbound messages dropped per event type
+type dropCounter struct {
+	mu     sync.RWMutex
+	counts map[string]*atomic.Uint64
+}
+
+// newDropCounter creates an empty drop counter
+func newDropCounter() *dropCounter {
+	return &dropCounter{
+		counts: make(map[string]*atomic.Uint64),
+	}
+}
+
+// add records a dropped message
+func (d *dropCounter) add(event string) {
+	d.mu.RLock()
+	counter, ok := d.counts[event]
+	d.mu.RUnlock()
+
+	if !ok {
+		d.mu.Lock()
+		if counter, ok = d.counts[event]; !ok {
+			counter = new(atomic.Uint64)
+			d.counts[event] = counter
+		}
+		d.mu.Unlock()
+	}
+
+	counter.Add(1)
+}
+
+// Snapshot returns the drop counts per event type
+func (d *dropCounter) Snapshot() map[string]uint64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	snapshot := make(map[string]uint64, len(d.counts))
+	for event, counter := range d.counts {
+		snapshot[event] = counter.Load()
+	}
+	return snapshot
+}
@@ -0,0 +1,208 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenBucket allows rate events per second with bursts of up to burst events
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a full bucket
+func newTokenBucket(limit config.RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  float64(limit.Burst),
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// refill adds the tokens accumulated since the last call
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take consumes a token. If none is left it returns how long until one is.
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// rateLimiter keeps a token bucket per event type. Events without their
+// own limit share the bucket of the default ("*") limit.
+type rateLimiter struct {
+	limits config.RateLimits
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// newRateLimiter creates a rate limiter, or nil if no limits are configured
+func newRateLimiter(limits config.RateLimits) *rateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	return &rateLimiter{
+		limits:  limits,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow consumes a token for the event. A nil limiter allows everything.
+func (l *rateLimiter) allow(event string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	key, limit, ok := l.limits.For(event)
+	if !ok {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = newTokenBucket(limit, now)
+		l.buckets[key] = bucket
+	}
+	return bucket.take(now)
+}
+
+// idle reports whether all buckets have refilled, so dropping the limiter
+// loses no state
+func (l *rateLimiter) idle(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, bucket := range l.buckets {
+		bucket.refill(now)
+		if bucket.tokens < bucket.burst {
+			return false
+		}
+	}
+	return true
+}
+
+// userRateLimiters shares rate limiters between all connections of a user
+type userRateLimiters struct {
+	limits config.RateLimits
+
+	mu       sync.Mutex
+	limiters map[int]*rateLimiter
+}
+
+// newUserRateLimiters creates per-user rate limiters, or nil if no limits are configured
+func newUserRateLimiters(limits config.RateLimits) *userRateLimiters {
+	if len(limits) == 0 {
+		return nil
+	}
+	return &userRateLimiters{
+		limits:   limits,
+		limiters: make(map[int]*rateLimiter),
+	}
+}
+
+// get returns the user's rate limiter (nil if limiting is disabled)
+func (u *userRateLimiters) get(userID int) *rateLimiter {
+	if u == nil {
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	limiter, ok := u.limiters[userID]
+	if !ok {
+		limiter = newRateLimiter(u.limits)
+		u.limiters[userID] = limiter
+	}
+	return limiter
+}
+
+// PurgeIdle drops limiters of users whose buckets have refilled
+func (u *userRateLimiters) PurgeIdle() {
+	if u == nil {
+		return
+	}
+
+	now := time.Now()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for userID, limiter := range u.limiters {
+		if limiter.idle(now) {
+			delete(u.limiters, userID)
+		}
+	}
+}
+
+// violationCounter counts rate limit violations in fixed windows
+type violationCounter struct {
+	max    int
+	window time.Duration
+
+	count int
+	start time.Time
+}
+
+// add records a violation and reports whether the maximum was exceeded.
+// A zero max never reports abuse.
+func (v *violationCounter) add(now time.Time) bool {
+	if v.max <= 0 {
+		return false
+	}
+	if now.Sub(v.start) > v.window {
+		v.count = 0
+		v.start = now
+	}
+	v.count++
+	return v.count > v.max
+}
+
+// allowEvent applies the connection and user rate limits to an inbound event.
+// Rejected events get a RATE_LIMITED error; sustained abuse closes the connection.
+func (h *Hub) allowEvent(conn *Connection, msg *models.WebSocketMessage) bool {
+	now := time.Now()
+
+	ok, retryAfter := conn.limiter.allow(msg.Event, now)
+	if ok {
+		if user := conn.GetUser(); user != nil {
+			ok, retryAfter = h.userLimiters.get(user.ID).allow(msg.Event, now)
+		}
+	}
+	if ok {
+		return true
+	}
+
+	conn.SendErrorData(msg.ID, models.ErrorData{
+		Message:      "Rate limit exceeded",
+		Code:         models.ErrCodeRateLimited,
+		RetryAfterMs: int(retryAfter.Milliseconds()) + 1,
+	})
+
+	if conn.violations.add(now) {
+		log.Printf("Closing connection: sustained rate limit violations (%s)", msg.Event)
+		conn.CloseWithCode(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+
+	"buzzchat-gogate/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// beginHandler reserves an in-flight handler slot.
+// Returns false once shutdown has begun.
+func (h *Hub) beginHandler() bool {
+	h.shutdownMu.RLock()
+	defer h.shutdownMu.RUnlock()
+
+	if h.stopping {
+		return false
+	}
+	h.handlers.Add(1)
+	return true
+}
+
+// endHandler releases an in-flight handler slot
+func (h *Hub) endHandler() {
+	h.handlers.Done()
+}
+
+// IsShuttingDown reports whether shutdown has begun
+func (h *Hub) IsShuttingDown() bool {
+	h.shutdownMu.RLock()
+	defer h.shutdownMu.RUnlock()
+	return h.stopping
+}
+
+// Shutdown notifies clients, waits for in-flight handlers, closes every
+// connection with a Service Restart close frame and stops the hub loop.
+// Returns ctx.Err() if the deadline passes before everything drained.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.shutdownMu.Lock()
+	if h.stopping {
+		h.shutdownMu.Unlock()
+		return nil
+	}
+	h.stopping = true
+	h.shutdownMu.Unlock()
+
+	clients := h.snapshotClients()
+	log.Printf("Shutting down hub, %d connections", len(clients))
+
+	// Tell clients to reconnect, spreading reconnects to avoid a thundering herd
+	for _, conn := range clients {
+		conn.SendMessage(models.EventServerShutdown, models.ServerShutdownData{
+			Reason:         "restart",
+			ReconnectAfter: reconnectAfter(h.reconnectDelay.Seconds()),
+		})
+	}
+
+	// Let in-flight handlers finish their backend calls and broadcasts
+	if err := waitContext(ctx, h.handlers.Wait); err != nil {
+		log.Printf("Timed out waiting for in-flight handlers")
+	}
+
+	for _, conn := range h.snapshotClients() {
+		conn.CloseWithCode(websocket.CloseServiceRestart, "server restart")
+	}
+
+	close(h.quit)
+
+	// Wait for write pumps to flush close frames
+	return waitContext(ctx, h.clientsWG.Wait)
+}
+
+// snapshotClients returns all started connections
+func (h *Hub) snapshotClients() []*Connection {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Connection, 0, len(h.clients))
+	for conn := range h.clients {
+		clients = append(clients, conn)
+	}
+	return clients
+}
+
+// reconnectAfter returns a reconnect delay in seconds with random jitter
+func reconnectAfter(delay float64) int {
+	seconds := int(delay)
+	if seconds <= 0 {
+		return 0
+	}
+	return seconds + rand.IntN(seconds+1)
+}
+
+// waitContext runs wait and returns early with ctx.Err() on deadline
+func waitContext(ctx context.Context, wait func()) error {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
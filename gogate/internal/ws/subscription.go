@@ -0,0 +1,293 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// maxSubscribeChats limits the chat IDs in one subscribe or unsubscribe event
+const maxSubscribeChats = 1000
+
+// handleSubscribe subscribes the connection to chats the user is a member of
+func (h *Hub) handleSubscribe(conn *Connection, msg *models.WebSocketMessage) {
+	data, ok := parseSubscribeData(conn, msg)
+	if !ok {
+		return
+	}
+
+	user := conn.GetUser()
+
+	// Authorize once; events of subscribed chats need no further checks
+	userChats, err := h.apiClient.GetUserChats(user.ID)
+	if err != nil {
+		log.Printf("Error getting chats of user %d: %v", user.ID, err)
+		conn.SendBackendError(msg.ID, "Failed to check chat membership", err)
+		return
+	}
+
+	isMember := make(map[int]bool, len(userChats))
+	for _, chatID := range userChats {
+		isMember[chatID] = true
+	}
+
+	var allowed, denied []int
+	for _, chatID := range data.ChatIDs {
+		if isMember[chatID] {
+			allowed = append(allowed, chatID)
+		} else {
+			denied = append(denied, chatID)
+		}
+	}
+
+	if len(allowed) == 0 {
+		conn.SendError(msg.ID, models.ErrCodeNotAMember, "You are not a member of these chats")
+		return
+	}
+
+	if !h.waitRegistered(conn) {
+		return
+	}
+
+	h.mu.Lock()
+	conn.manualSubscriptions = true
+	h.subscribe(conn, allowed)
+	result := models.SubscriptionsResult{ChatIDs: conn.subscribedChats(), Denied: denied}
+	h.mu.Unlock()
+
+	resultBytes, _ := json.Marshal(result)
+	conn.SendAck(msg.ID, models.EventSubscribe, resultBytes)
+}
+
+// handleUnsubscribe removes chat subscriptions of the connection
+func (h *Hub) handleUnsubscribe(conn *Connection, msg *models.WebSocketMessage) {
+	data, ok := parseSubscribeData(conn, msg)
+	if !ok {
+		return
+	}
+
+	if !h.waitRegistered(conn) {
+		return
+	}
+
+	h.mu.Lock()
+	conn.manualSubscriptions = true
+	user := conn.GetUser()
+	for _, chatID := range data.ChatIDs {
+		h.unsubscribe(conn, chatID)
+
+		// Stop logging the chat unless another connection still follows it
+		if !h.userSubscribed(user.ID, chatID) {
+			h.unlogChat(user.ID, chatID)
+		}
+	}
+	result := models.SubscriptionsResult{ChatIDs: conn.subscribedChats()}
+	h.mu.Unlock()
+
+	resultBytes, _ := json.Marshal(result)
+	conn.SendAck(msg.ID, models.EventUnsubscribe, resultBytes)
+}
+
+// parseSubscribeData decodes subscribe and unsubscribe data, replying with
+// an error if it is invalid
+func parseSubscribeData(conn *Connection, msg *models.WebSocketMessage) (models.SubscribeData, bool) {
+	var data models.SubscribeData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid subscription data")
+		return data, false
+	}
+
+	if len(data.ChatIDs) == 0 || len(data.ChatIDs) > maxSubscribeChats {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload,
+			fmt.Sprintf("chat_ids must contain 1 to %d chat IDs", maxSubscribeChats))
+		return data, false
+	}
+
+	return data, true
+}
+
+// userChats returns the chats a new connection is subscribed to
+func (h *Hub) userChats(userID int) []int {
+	chatIDs, err := h.apiClient.GetUserChats(userID)
+	if err != nil {
+		log.Printf("Error getting chats of user %d, connection has no subscriptions: %v", userID, err)
+		return nil
+	}
+	return chatIDs
+}
+
+// waitRegistered blocks until the hub registered the connection (or skipped
+// it, if closed). Returns false if the hub stopped first.
+func (h *Hub) waitRegistered(conn *Connection) bool {
+	select {
+	case <-conn.registered:
+		return true
+	case <-h.quit:
+		return false
+	}
+}
+
+// subscribe adds chat subscriptions of a registered connection and logs
+// the chats' events for its user. h.mu must be held.
+func (h *Hub) subscribe(conn *Connection, chatIDs []int) {
+	userID := conn.GetUser().ID
+
+	// Unregistered connections must not be left in the index
+	if !h.connections[userID][conn] {
+		return
+	}
+
+	// Events logged so far reached the connection only if it was subscribed
+	var lastSeq uint64
+	if eventLog, ok := h.eventLogs[userID]; ok {
+		lastSeq = eventLog.lastSeq()
+	}
+
+	for _, chatID := range chatIDs {
+		if _, ok := conn.chats[chatID]; ok {
+			continue
+		}
+		if h.subscriptions[chatID] == nil {
+			h.subscriptions[chatID] = make(map[*Connection]bool)
+		}
+		h.subscriptions[chatID][conn] = true
+		conn.chats[chatID] = lastSeq
+		h.logChat(userID, chatID)
+	}
+}
+
+// unsubscribe removes a chat subscription of a connection. The chat stays
+// in the user's event log. h.mu must be held.
+func (h *Hub) unsubscribe(conn *Connection, chatID int) {
+	delete(conn.chats, chatID)
+
+	if subscribers, ok := h.subscriptions[chatID]; ok {
+		delete(subscribers, conn)
+		if len(subscribers) == 0 {
+			delete(h.subscriptions, chatID)
+		}
+	}
+}
+
+// unsubscribeAll removes all subscriptions of a closing connection. Its
+// chats stay in the user's event log, so they can be resumed. h.mu must be held.
+func (h *Hub) unsubscribeAll(conn *Connection) {
+	for chatID := range conn.chats {
+		h.unsubscribe(conn, chatID)
+	}
+}
+
+// userSubscribed reports whether any connection of a user is subscribed to
+// a chat. h.mu must be held.
+func (h *Hub) userSubscribed(userID, chatID int) bool {
+	for conn := range h.connections[userID] {
+		if _, ok := conn.chats[chatID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// logChat records a chat's events in a user's event log. h.mu must be held.
+func (h *Hub) logChat(userID, chatID int) {
+	eventLog, ok := h.eventLogs[userID]
+	if !ok {
+		return
+	}
+
+	eventLog.chats[chatID] = true
+	if h.chatLogs[chatID] == nil {
+		h.chatLogs[chatID] = make(map[int]bool)
+	}
+	h.chatLogs[chatID][userID] = true
+}
+
+// unlogChat stops recording a chat's events in a user's event log.
+// h.mu must be held.
+func (h *Hub) unlogChat(userID, chatID int) {
+	if eventLog, ok := h.eventLogs[userID]; ok {
+		delete(eventLog.chats, chatID)
+	}
+
+	if users, ok := h.chatLogs[chatID]; ok {
+		delete(users, userID)
+		if len(users) == 0 {
+			delete(h.chatLogs, chatID)
+		}
+	}
+}
+
+// chatRecipients groups the connections subscribed to a chat by user.
+// Users who log the chat without a subscribed connection get an empty
+// set, so durable events are still logged for resume. h.mu must be held.
+func (h *Hub) chatRecipients(chatID int) map[int]map[*Connection]bool {
+	recipients := make(map[int]map[*Connection]bool)
+	for userID := range h.chatLogs[chatID] {
+		recipients[userID] = nil
+	}
+	for conn := range h.subscriptions[chatID] {
+		userID := conn.GetUser().ID
+		if recipients[userID] == nil {
+			recipients[userID] = make(map[*Connection]bool)
+		}
+		recipients[userID][conn] = true
+	}
+	return recipients
+}
+
+// hasFormerMembers reports whether users who aren't members of a chat are
+// subscribed to it or log it. h.mu must be held.
+func (h *Hub) hasFormerMembers(chatID int, members map[int]struct{}) bool {
+	for userID := range h.chatLogs[chatID] {
+		if _, ok := members[userID]; !ok {
+			return true
+		}
+	}
+	for conn := range h.subscriptions[chatID] {
+		if _, ok := members[conn.GetUser().ID]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSubscriptions matches a chat's subscriptions to its current members:
+// former members are unsubscribed and stop logging the chat and, with
+// auto-subscribe, connections of new members are subscribed. h.mu must be held.
+func (h *Hub) syncSubscriptions(chatID int, members map[int]struct{}) {
+	for conn := range h.subscriptions[chatID] {
+		if _, ok := members[conn.GetUser().ID]; !ok {
+			h.unsubscribe(conn, chatID)
+		}
+	}
+	for userID := range h.chatLogs[chatID] {
+		if _, ok := members[userID]; !ok {
+			h.unlogChat(userID, chatID)
+		}
+	}
+
+	if !h.autoSubscribe {
+		return
+	}
+	for userID := range members {
+		for conn := range h.connections[userID] {
+			if !conn.manualSubscriptions {
+				h.subscribe(conn, []int{chatID})
+			}
+		}
+	}
+}
+
+// subscribedChats returns the connection's subscribed chat IDs in ascending
+// order. hub.mu must be held.
+func (c *Connection) subscribedChats() []int {
+	chatIDs := make([]int, 0, len(c.chats))
+	for chatID := range c.chats {
+		chatIDs = append(chatIDs, chatID)
+	}
+	slices.Sort(chatIDs)
+	return chatIDs
+}
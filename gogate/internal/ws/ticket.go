@@ -0,0 +1,243 @@
+package ws
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/broker"
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/models"
+)
+
+// ticketBytes is the amount of randomness in a ticket
+const ticketBytes = 32
+
+// ticketKeyPrefix namespaces tickets in a shared store
+const ticketKeyPrefix = "gogate:ticket:"
+
+// ErrInvalidTicket is returned for unknown, expired or already used tickets
+var ErrInvalidTicket = errors.New("invalid ticket")
+
+// ticket is a pending single-use connection ticket
+type ticket struct {
+	user        *models.User
+	token       string
+	tokenExpiry time.Time
+	expiresAt   time.Time
+}
+
+// sharedTicket is a ticket as kept in a shared store, which expires it
+type sharedTicket struct {
+	User        *models.User `json:"user"`
+	Token       string       `json:"token"`
+	TokenExpiry int64        `json:"token_expiry,omitempty"`
+}
+
+// TicketStore keeps short-lived single-use connection tickets. A ticket
+// stands in for the access token in the /ws URL so long-lived JWTs never
+// appear in URLs or access logs. Tickets are kept in memory, or in a shared
+// store if set, so that any gateway instance can redeem them.
+type TicketStore struct {
+	ttl    time.Duration
+	shared broker.Store
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+// NewTicketStore creates a ticket store with the given ticket lifetime.
+// A nil shared store keeps tickets in this instance's memory.
+func NewTicketStore(ttl time.Duration, shared broker.Store) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		shared:  shared,
+		tickets: make(map[string]ticket),
+	}
+}
+
+// Issue creates a ticket for an authenticated user
+func (s *TicketStore) Issue(user *models.User, token string, tokenExpiry time.Time) (string, time.Time, error) {
+	buf := make([]byte, ticketBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("generate ticket: %w", err)
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(s.ttl)
+
+	if s.shared != nil {
+		payload, err := json.Marshal(sharedTicket{
+			User:        user,
+			Token:       token,
+			TokenExpiry: expiryUnix(tokenExpiry),
+		})
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("marshal ticket: %w", err)
+		}
+		if err := s.shared.Put(ticketKeyPrefix+id, string(payload), s.ttl); err != nil {
+			return "", time.Time{}, fmt.Errorf("store ticket: %w", err)
+		}
+		return id, expiresAt, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tickets[id] = ticket{
+		user:        user,
+		token:       token,
+		tokenExpiry: tokenExpiry,
+		expiresAt:   expiresAt,
+	}
+
+	return id, expiresAt, nil
+}
+
+// Redeem consumes a ticket. A ticket can be redeemed only once and only
+// before it expires; otherwise ErrInvalidTicket is returned.
+func (s *TicketStore) Redeem(id string) (*models.User, string, time.Time, error) {
+	if s.shared != nil {
+		return s.redeemShared(id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tickets[id]
+	if !ok {
+		return nil, "", time.Time{}, ErrInvalidTicket
+	}
+	delete(s.tickets, id)
+
+	if time.Now().After(t.expiresAt) {
+		return nil, "", time.Time{}, ErrInvalidTicket
+	}
+
+	return t.user, t.token, t.tokenExpiry, nil
+}
+
+// redeemShared consumes a ticket from the shared store
+func (s *TicketStore) redeemShared(id string) (*models.User, string, time.Time, error) {
+	payload, ok, err := s.shared.Take(ticketKeyPrefix + id)
+	if err != nil {
+		return nil, "", time.Time{}, fmt.Errorf("take ticket: %w", err)
+	}
+	if !ok {
+		return nil, "", time.Time{}, ErrInvalidTicket
+	}
+
+	var t sharedTicket
+	if err := json.Unmarshal([]byte(payload), &t); err != nil || t.User == nil {
+		return nil, "", time.Time{}, fmt.Errorf("malformed ticket: %w", ErrInvalidTicket)
+	}
+
+	var tokenExpiry time.Time
+	if t.TokenExpiry > 0 {
+		tokenExpiry = time.Unix(t.TokenExpiry, 0)
+	}
+	return t.User, t.Token, tokenExpiry, nil
+}
+
+// PurgeExpired drops tickets that were never redeemed
+func (s *TicketStore) PurgeExpired() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tickets {
+		if now.After(t.expiresAt) {
+			delete(s.tickets, id)
+		}
+	}
+}
+
+// TicketHandler issues connection tickets in exchange for a bearer token
+type TicketHandler struct {
+	hub     *Hub
+	origins *originPolicy
+}
+
+// NewTicketHandler creates a new ticket handler
+func NewTicketHandler(hub *Hub, cfg *config.Config) (*TicketHandler, error) {
+	origins, err := newOriginPolicy(cfg.AllowedOrigins, cfg.DevMode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TicketHandler{
+		hub:     hub,
+		origins: origins,
+	}, nil
+}
+
+// ServeHTTP handles ticket requests from clients
+func (h *TicketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Browsers call this endpoint cross-origin, allow the same origins as /ws
+	if ok, reason := h.origins.check(r); !ok {
+		log.Printf("Rejected ticket request from %s: %s", r.RemoteAddr, reason)
+		writeJSONError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Vary", "Origin")
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if h.hub.IsShuttingDown() {
+		writeJSONError(w, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		writeJSONError(w, http.StatusUnauthorized, "Bearer token required")
+		return
+	}
+
+	user, tokenExpiry, err := h.hub.apiClient.ValidateToken(token)
+	if err != nil {
+		log.Printf("Ticket auth failed from %s: %v", r.RemoteAddr, err)
+		if errors.Is(err, api.ErrUnavailable) {
+			writeJSONError(w, http.StatusServiceUnavailable, "Authentication unavailable")
+		} else {
+			writeJSONError(w, http.StatusUnauthorized, "Authentication failed")
+		}
+		return
+	}
+
+	id, expiresAt, err := h.hub.tickets.Issue(user, token, tokenExpiry)
+	if err != nil {
+		log.Printf("Error issuing ticket: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Failed to issue ticket")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(models.TicketResponse{
+		Ticket:    id,
+		ExpiresIn: int(time.Until(expiresAt).Round(time.Second).Seconds()),
+	})
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// mapStore is a broker.Store shared by several ticket stores, like Redis
+// shared by several instances
+type mapStore struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (s *mapStore) Put(key, value string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return nil
+}
+
+func (s *mapStore) Take(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	delete(s.values, key)
+	return value, ok, nil
+}
+
+func TestTicketStoreRedeemOnce(t *testing.T) {
+	memory := NewTicketStore(time.Minute, nil)
+	shared := &mapStore{values: make(map[string]string)}
+
+	// Shared tickets are redeemed by another instance
+	tests := []struct {
+		name     string
+		issuer   *TicketStore
+		redeemer *TicketStore
+	}{
+		{"memory", memory, memory},
+		{"shared", NewTicketStore(time.Minute, shared), NewTicketStore(time.Minute, shared)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redeemer := tt.redeemer
+			user := &models.User{ID: 7, Name: "Jane"}
+			tokenExpiry := time.Unix(1761408000, 0)
+			id, _, err := tt.issuer.Issue(user, "jwt", tokenExpiry)
+			if err != nil {
+				t.Fatalf("Issue failed: %v", err)
+			}
+
+			gotUser, token, gotExpiry, err := redeemer.Redeem(id)
+			if err != nil {
+				t.Fatalf("Redeem failed: %v", err)
+			}
+			if gotUser.ID != user.ID || token != "jwt" || !gotExpiry.Equal(tokenExpiry) {
+				t.Errorf("Redeem = user %d, token %q, expiry %v", gotUser.ID, token, gotExpiry)
+			}
+
+			if _, _, _, err := redeemer.Redeem(id); !errors.Is(err, ErrInvalidTicket) {
+				t.Errorf("second Redeem error = %v, want ErrInvalidTicket", err)
+			}
+		})
+	}
+}
+
+func TestTicketStoreExpired(t *testing.T) {
+	store := NewTicketStore(time.Millisecond, nil)
+
+	id, _, err := store.Issue(&models.User{ID: 7}, "jwt", time.Time{})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, _, err := store.Redeem(id); !errors.Is(err, ErrInvalidTicket) {
+		t.Errorf("Redeem error = %v, want ErrInvalidTicket", err)
+	}
+}
@@ -0,0 +1,201 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"buzzchat-gogate/internal/models"
+)
+
+// typingKey identifies a user typing in a chat
+type typingKey struct {
+	userID int
+	chatID int
+}
+
+// typingState is an active typing indicator
+type typingState struct {
+	// Connection the user is typing on
+	conn *Connection
+
+	// User name sent with the indicator
+	name string
+
+	// Last is_typing:true broadcast
+	lastBroadcast time.Time
+
+	// Set while the user is typing. A stopped state is kept until the
+	// throttle interval since lastBroadcast passed, so toggling is_typing
+	// doesn't bypass the throttle.
+	active bool
+
+	// Set if chat peers were last told that the user is typing
+	shown bool
+
+	// Broadcasts is_typing:false when the client stops sending typing, or
+	// drops a stopped state once the throttle interval passed
+	expiry *time.Timer
+}
+
+// typingTracker coalesces typing indicators and expires stale ones
+type typingTracker struct {
+	// Minimum interval between is_typing:true broadcasts per user and chat
+	throttle time.Duration
+
+	// Time after the last typing event before the indicator is cleared
+	timeout time.Duration
+
+	mu     sync.Mutex
+	states map[typingKey]*typingState
+}
+
+// newTypingTracker creates a typing tracker
+func newTypingTracker(throttle, timeout time.Duration) *typingTracker {
+	return &typingTracker{
+		throttle: throttle,
+		timeout:  timeout,
+		states:   make(map[typingKey]*typingState),
+	}
+}
+
+// handleTyping handles typing indicator
+func (h *Hub) handleTyping(conn *Connection, msg *models.WebSocketMessage) {
+	var data models.TypingData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid typing data")
+		return
+	}
+
+	if data.ChatID <= 0 {
+		conn.SendError(msg.ID, models.ErrCodeInvalidPayload, "Invalid chat_id")
+		return
+	}
+
+	user := conn.GetUser()
+
+	// Only members may broadcast into a chat
+	isMember, err := h.members.IsMember(data.ChatID, user.ID)
+	if err != nil {
+		log.Printf("Error checking chat membership: %v", err)
+		conn.SendBackendError(msg.ID, "Failed to check chat membership", err)
+		return
+	}
+	if !isMember {
+		conn.SendError(msg.ID, models.ErrCodeNotAMember, "You are not a member of this chat")
+		return
+	}
+
+	key := typingKey{userID: user.ID, chatID: data.ChatID}
+	if data.IsTyping {
+		h.startTyping(key, conn, user.Name)
+	} else {
+		h.stopTyping(key, nil)
+	}
+}
+
+// startTyping records that a user is typing and broadcasts it unless
+// the previous broadcast was less than the throttle interval ago
+func (h *Hub) startTyping(key typingKey, conn *Connection, name string) {
+	t := h.typing
+	now := time.Now()
+
+	t.mu.Lock()
+	state, ok := t.states[key]
+	if !ok {
+		state = &typingState{}
+		t.states[key] = state
+	}
+	state.conn = conn
+	state.name = name
+	state.active = true
+
+	// Every typing event pushes the expiry back
+	if state.expiry != nil {
+		state.expiry.Stop()
+	}
+	state.expiry = time.AfterFunc(t.timeout, func() {
+		h.stopTyping(key, state)
+	})
+
+	broadcast := now.Sub(state.lastBroadcast) >= t.throttle
+	if broadcast {
+		state.lastBroadcast = now
+		state.shown = true
+	}
+	t.mu.Unlock()
+
+	if broadcast {
+		h.broadcastTyping(key, name, true)
+	}
+}
+
+// stopTyping clears a typing indicator and broadcasts is_typing:false if
+// peers were told the user is typing. If expected is set, the indicator is
+// cleared only if it is still that state.
+func (h *Hub) stopTyping(key typingKey, expected *typingState) {
+	t := h.typing
+
+	t.mu.Lock()
+	state, ok := t.states[key]
+	if !ok || !state.active || (expected != nil && state != expected) {
+		t.mu.Unlock()
+		return
+	}
+	state.active = false
+	state.conn = nil
+	shown := state.shown
+	state.shown = false
+	state.expiry.Stop()
+
+	// Keep the last broadcast time until the throttle interval passed
+	if remaining := t.throttle - time.Since(state.lastBroadcast); remaining > 0 {
+		state.expiry = time.AfterFunc(remaining, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.states[key] == state && !state.active {
+				delete(t.states, key)
+			}
+		})
+	} else {
+		delete(t.states, key)
+	}
+	t.mu.Unlock()
+
+	if shown {
+		h.broadcastTyping(key, state.name, false)
+	}
+}
+
+// clearTyping stops all typing indicators of a closed connection
+func (h *Hub) clearTyping(conn *Connection) {
+	t := h.typing
+
+	t.mu.Lock()
+	var stopped []typingKey
+	var states []*typingState
+	for key, state := range t.states {
+		if state.conn == conn {
+			stopped = append(stopped, key)
+			states = append(states, state)
+		}
+	}
+	t.mu.Unlock()
+
+	for i, key := range stopped {
+		h.stopTyping(key, states[i])
+	}
+}
+
+// broadcastTyping sends a user_typing event to chat members (excluding the typing user)
+func (h *Hub) broadcastTyping(key typingKey, name string, isTyping bool) {
+	typingData := models.UserTypingData{
+		ChatID:   key.chatID,
+		UserID:   key.userID,
+		Name:     name,
+		IsTyping: isTyping,
+	}
+
+	h.BroadcastToChatMembers(key.chatID, models.EventUserTyping, typingData, &key.userID)
+}
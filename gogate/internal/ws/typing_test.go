@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"buzzchat-gogate/internal/api"
+	"buzzchat-gogate/internal/broker"
+	"buzzchat-gogate/internal/config"
+	"buzzchat-gogate/internal/metrics"
+	"buzzchat-gogate/internal/models"
+)
+
+// recordingBroker records published envelopes instead of delivering them
+type recordingBroker struct {
+	mu        sync.Mutex
+	envelopes []broker.Envelope
+}
+
+func (b *recordingBroker) Subscribe(broker.Handler) error { return nil }
+func (b *recordingBroker) Close() error                   { return nil }
+
+func (b *recordingBroker) Publish(env broker.Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.envelopes = append(b.envelopes, env)
+	return nil
+}
+
+// typingBroadcasts returns the is_typing values broadcast so far
+func (b *recordingBroker) typingBroadcasts(t *testing.T) []bool {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var got []bool
+	for _, env := range b.envelopes {
+		var data models.UserTypingData
+		if err := json.Unmarshal(env.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, data.IsTyping)
+	}
+	return got
+}
+
+// newTypingHub creates a hub that is never run, recording typing broadcasts
+func newTypingHub(t *testing.T, throttle time.Duration) (*Hub, *recordingBroker) {
+	t.Helper()
+
+	reg := metrics.NewRegistry()
+	bus := &recordingBroker{}
+	hub, err := NewHub(api.NewClient("http://127.0.0.1:0", "", reg), bus, reg, &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.typing = newTypingTracker(throttle, time.Minute)
+	return hub, bus
+}
+
+func TestTypingToggleIsThrottled(t *testing.T) {
+	hub, bus := newTypingHub(t, time.Hour)
+	key := typingKey{userID: 1, chatID: 2}
+
+	for i := 0; i < 3; i++ {
+		hub.startTyping(key, nil, "Jane")
+		hub.stopTyping(key, nil)
+	}
+
+	got := bus.typingBroadcasts(t)
+	if len(got) != 2 || !got[0] || got[1] {
+		t.Errorf("got broadcasts %v, want [true false]", got)
+	}
+}
+
+func TestTypingAfterThrottle(t *testing.T) {
+	hub, bus := newTypingHub(t, 10*time.Millisecond)
+	key := typingKey{userID: 1, chatID: 2}
+
+	hub.startTyping(key, nil, "Jane")
+	hub.stopTyping(key, nil)
+	time.Sleep(20 * time.Millisecond)
+	hub.startTyping(key, nil, "Jane")
+
+	got := bus.typingBroadcasts(t)
+	if len(got) != 3 || !got[2] {
+		t.Errorf("got broadcasts %v, want [true false true]", got)
+	}
+}